@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+var KindAdmonition = ast.NewNodeKind("Admonition")
+
+// Admonition is a callout block written as a blockquote whose first line is
+// a marker, GitHub style:
+//
+//	> [!WARNING] Optional title
+//	> Body of the callout.
+type Admonition struct {
+	ast.BaseBlock
+	Variant string
+	Title   string
+}
+
+func (n *Admonition) Kind() ast.NodeKind { return KindAdmonition }
+
+func (n *Admonition) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Variant": n.Variant, "Title": n.Title}, nil)
+}
+
+// Admonitions is a goldmark extension that renders callout blocks.
+var Admonitions = &admonitionExtension{}
+
+type admonitionExtension struct{}
+
+func (e *admonitionExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithASTTransformers(util.Prioritized(&admonitionTransformer{}, 100)),
+	)
+	m.Renderer().AddOptions(
+		renderer.WithNodeRenderers(util.Prioritized(&admonitionRenderer{}, 100)),
+	)
+}
+
+var admonitionMarker = regexp.MustCompile(`^\[!([A-Za-z]+)\][ \t]*(.*)$`)
+
+type admonitionTransformer struct{}
+
+func (t *admonitionTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var quotes []*ast.Blockquote
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if bq, ok := n.(*ast.Blockquote); ok && entering {
+			quotes = append(quotes, bq)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, bq := range quotes {
+		para, ok := bq.FirstChild().(*ast.Paragraph)
+		if !ok || para.Lines().Len() == 0 {
+			continue
+		}
+		first := para.Lines().At(0)
+		line := strings.TrimRight(string(first.Value(source)), " \t\r\n")
+		match := admonitionMarker.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		lineStop := first.Start + len(line)
+
+		// Drop the inline nodes belonging to the marker line.
+		for child := para.FirstChild(); child != nil; {
+			next := child.NextSibling()
+			para.RemoveChild(para, child)
+			if txt, ok := child.(*ast.Text); ok && (txt.Segment.Stop >= lineStop || txt.SoftLineBreak() || txt.HardLineBreak()) {
+				break
+			}
+			child = next
+		}
+		if !para.HasChildren() {
+			bq.RemoveChild(bq, para)
+		}
+
+		admonition := &Admonition{
+			Variant: strings.ToLower(match[1]),
+			Title:   match[2],
+		}
+		if admonition.Title == "" {
+			admonition.Title = strings.ToUpper(admonition.Variant[:1]) + admonition.Variant[1:]
+		}
+		for child := bq.FirstChild(); child != nil; {
+			next := child.NextSibling()
+			admonition.AppendChild(admonition, child)
+			child = next
+		}
+		bq.Parent().ReplaceChild(bq.Parent(), bq, admonition)
+	}
+}
+
+type admonitionRenderer struct{}
+
+func (r *admonitionRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindAdmonition, r.render)
+}
+
+func (r *admonitionRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*Admonition)
+	if entering {
+		w.WriteString(fmt.Sprintf("<aside class=\"admonition admonition-%v\">\n", html.EscapeString(n.Variant)))
+		w.WriteString(fmt.Sprintf("<p class=\"admonition-title\">%v</p>\n", html.EscapeString(n.Title)))
+	} else {
+		w.WriteString("</aside>\n")
+	}
+	return ast.WalkContinue, nil
+}
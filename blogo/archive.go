@@ -0,0 +1,46 @@
+package main
+
+import (
+	"time"
+)
+
+// Returns the listed posts of a language grouped by year and month, newest
+// first. Dates are grouped in the timezone of the site, so a post from the
+// night of December 31st is not filed under the next year.
+func Archive(lang string) []ArchiveYear {
+	var years []ArchiveYear
+	for _, article := range ListedArticles(lang) {
+		date := article.Date.In(Site().Config.Location)
+
+		if len(years) == 0 || years[len(years)-1].Year != date.Year() {
+			years = append(years, ArchiveYear{Year: date.Year()})
+		}
+		year := &years[len(years)-1]
+		if len(year.Months) == 0 || year.Months[len(year.Months)-1].Month != date.Month() {
+			year.Months = append(year.Months, ArchiveMonth{Year: date.Year(), Month: date.Month()})
+		}
+		month := &year.Months[len(year.Months)-1]
+		month.Articles = append(month.Articles, article)
+		year.Count++
+	}
+	return years
+}
+
+// Returns the part of the archive of a year, or of a month when month is not
+// zero
+func FilterArchive(years []ArchiveYear, year int, month time.Month) []ArchiveYear {
+	for _, y := range years {
+		if y.Year != year {
+			continue
+		}
+		if month == 0 {
+			return []ArchiveYear{y}
+		}
+		for _, m := range y.Months {
+			if m.Month == month {
+				return []ArchiveYear{{Year: year, Count: len(m.Articles), Months: []ArchiveMonth{m}}}
+			}
+		}
+	}
+	return nil
+}
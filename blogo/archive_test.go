@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestArchiveFilesPostsInSiteTimezone(t *testing.T) {
+	withTimezone(t, "Europe/Berlin")
+	withBadger(t)
+
+	// 22:30 UTC, but already the last night of the year in Berlin
+	date, err := parseDate("2024-12-31 23:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if date.Year() != 2024 || date.Month() != time.December || date.Day() != 31 || date.Hour() != 23 {
+		t.Fatalf("parseDate = %v, want 2024-12-31 23:30 in Berlin", date)
+	}
+
+	article := ArticleData{Slug: "new-years-eve", Title: "New Year's Eve", Date: date, Lang: Site().Config.Language}
+	if err := Badger.SetArticle(article); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Badger.DeleteArticle(article.Slug) })
+
+	years := Archive(article.Lang)
+	if len(years) != 1 || years[0].Year != 2024 || years[0].Months[0].Month != time.December {
+		t.Errorf("Archive filed the post under %+v, want December 2024", years)
+	}
+
+	if got, want := expandPermalink("/{year}/{month}/{slug}/", article), "/2024/12/new-years-eve/"; got != want {
+		t.Errorf("expandPermalink = %v, want %v", got, want)
+	}
+}
+
+func TestParseDateKeepsExplicitOffset(t *testing.T) {
+	withTimezone(t, "Europe/Berlin")
+
+	// The instant is kept, and shown in the timezone of the site
+	date, err := parseDate("2024-06-30T23:30:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !date.Equal(time.Date(2024, 6, 30, 23, 30, 0, 0, time.UTC)) {
+		t.Errorf("parseDate changed the instant: %v", date)
+	}
+	if date.Month() != time.July || date.Day() != 1 {
+		t.Errorf("parseDate = %v, want July 1st in Berlin", date)
+	}
+}
+
+func TestFilterArchive(t *testing.T) {
+	years := []ArchiveYear{
+		{Year: 2024, Count: 2, Months: []ArchiveMonth{
+			{Year: 2024, Month: time.May, Articles: []ArticleData{{Slug: "b"}}},
+			{Year: 2024, Month: time.March, Articles: []ArticleData{{Slug: "a"}}},
+		}},
+		{Year: 2023, Count: 1, Months: []ArchiveMonth{
+			{Year: 2023, Month: time.March, Articles: []ArticleData{{Slug: "c"}}},
+		}},
+	}
+
+	if got := FilterArchive(years, 2024, 0); len(got) != 1 || got[0].Count != 2 {
+		t.Errorf("FilterArchive(2024) = %+v", got)
+	}
+	if got := FilterArchive(years, 2024, time.March); len(got) != 1 || got[0].Count != 1 || got[0].Months[0].Articles[0].Slug != "a" {
+		t.Errorf("FilterArchive(2024, March) = %+v", got)
+	}
+	if got := FilterArchive(years, 2023, time.May); got != nil {
+		t.Errorf("FilterArchive(2023, May) = %+v, want nothing", got)
+	}
+}
@@ -2,84 +2,58 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
 	"os"
 	"path"
 	"path/filepath"
-	"strconv"
+	"sort"
 	"strings"
 	"time"
 
-	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
-	"github.com/rs/zerolog/log"
-	"github.com/yuin/goldmark"
-	highlighting "github.com/yuin/goldmark-highlighting/v2"
-	meta "github.com/yuin/goldmark-meta"
-	"github.com/yuin/goldmark/extension"
-	"github.com/yuin/goldmark/parser"
-	"github.com/yuin/goldmark/renderer/html"
+	"github.com/prometheus/client_golang/prometheus"
 	"gopkg.in/yaml.v2"
 )
 
-var About struct {
-	Slug string
-	Data ArticleData
-}
-
-var markdown goldmark.Markdown
-
-func InitGoldmark() {
-	markdown = goldmark.New(
-		goldmark.WithExtensions(
-			meta.Meta,
-			extension.GFM,
-			extension.Footnote,
-			highlighting.NewHighlighting(
-				highlighting.WithStyle("monokai"),
-				highlighting.WithFormatOptions(
-					chromahtml.WithLineNumbers(true),
-				),
-			),
-		),
-		goldmark.WithParserOptions(
-			parser.WithAutoHeadingID(),
-		),
-		goldmark.WithRendererOptions(
-			html.WithHardWraps(),
-			html.WithXHTML(),
-		),
-	)
-}
-
-// Loads all articles from the articles folder
+// Loads all articles from the articles folder. A broken article is reported
+// and skipped, it never prevents the others from loading.
 func LoadArticles() error {
+	defer prometheus.NewTimer(loadDuration).ObserveDuration()
 	InitGoldmark()
-	var slugs []string
-	err := filepath.Walk(path.Join(os.Getenv("CONTENT_PATH"), "/articles/"), func(fpath string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
 
-		if !info.IsDir() && strings.HasSuffix(info.Name(), ".md") {
-			article, err := GetArticleFromFile(fpath)
-			if err != nil {
-				log.Error().Msgf("Could not get article from file %v", fpath)
-				return err
-			}
+	// Pages and data go first, they are rendered into every article
+	if err := LoadPages(); err != nil {
+		Log("content").Error().Err(err).Msg("Error loading pages")
+	}
+	if err := LoadData(); err != nil {
+		Log("content").Error().Err(err).Msg("Error loading data files")
+	}
+	if err := LoadRedirects(); err != nil {
+		Log("content").Error().Err(err).Msg("Error loading redirects")
+	}
 
-			err = LoadArticle(article)
-			if err != nil {
+	root := path.Join(Site().Config.ContentPath, "/articles/")
+	var slugs []string
+	loaded := 0
+	err := filepath.Walk(root, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if fpath == root {
 				return err
 			}
+			Log("content").Error().Err(err).Msgf("Could not access %v", fpath)
+			SetLoadError(fpath, err)
+			return nil
+		}
 
-			err = GenerateArticleStatic(article)
-			if err != nil {
-				return err
-			}
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".md") && !isLegacyAbout(fpath) {
+			// Keep the slug even if loading fails, so the last good version
+			// of the article is not removed below.
 			slugs = append(slugs, strings.TrimSuffix(info.Name(), ".md"))
+			if err := ReloadArticle(fpath); err != nil {
+				return nil
+			}
+			loaded++
 		}
 		return nil
 	})
@@ -91,66 +65,135 @@ func LoadArticles() error {
 	// Remove articles that are no longer in the articles folder from Redis
 	articleSlugs, err := Badger.GetAllArticleSlugs()
 	if err != nil {
-		log.Err(err).Msg("Error getting articles from Redis")
+		Log("content").Err(err).Msg("Error getting articles from Redis")
 		articleSlugs = []string{}
 	}
 	left, _ := Difference(articleSlugs, slugs)
 	if len(left) > 0 {
-		log.Printf("Removing %v articles from Badger. Left articles: %v", len(left), slugs)
+		Log("content").Info().Strs("left", left).Msgf("Removing %v articles from Badger", len(left))
 	}
 	for _, articleSlug := range left {
 		if !StringInSlice(articleSlug, slugs) {
-			RemoveArticle(fmt.Sprintf("%v/articles/%v.md", os.Getenv("CONTENT_PATH"), articleSlug))
+			RemoveArticle(fmt.Sprintf("%v/articles/%v.md", Site().Config.ContentPath, articleSlug))
 		}
 	}
 
 	// Update the RSS feed
 	err = UpdateFeed()
 	if err != nil {
-		log.Err(err).Msg("Error updating RSS feed")
+		Log("content").Err(err).Msg("Error updating RSS feed")
+	}
+
+	errs := GetLoadErrors()
+	Log("content").Info().Int("articles", loaded).Int("errors", len(errs)).Msgf("Loaded %v articles, %v with errors", loaded, len(errs))
+	for _, e := range errs {
+		Log("content").Warn().Str("file", e.File).Msg(e.Error)
+	}
+	return nil
+}
+
+// Loads an article file, renders its static HTML and records the outcome in
+// the load errors report.
+func ReloadArticle(fpath string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while loading article: %v", r)
+		}
+		if err != nil {
+			Log("content").Error().Err(err).Str("file", fpath).Msg("Could not load article")
+			SetLoadError(fpath, err)
+		} else {
+			ClearLoadError(fpath)
+		}
+	}()
+
+	article, err := GetArticleFromFile(fpath)
+	if err != nil {
+		return err
+	}
+
+	err = LoadArticle(article)
+	if err != nil {
+		return err
+	}
+
+	if err := GenerateArticleStatic(article); err != nil {
+		return err
+	}
+
+	// The translations link to this article, which may be new
+	for _, translation := range ArticleTranslations(article) {
+		if translation.Slug != article.Slug {
+			// The index has no bodies
+			translation, err := Badger.GetPostBySlug(translation.Slug)
+			if err == nil {
+				err = GenerateArticleStatic(translation)
+			}
+			if err != nil {
+				Log("content").Error().Err(err).Msgf("Could not render translation %v", translation.Slug)
+			}
+		}
 	}
 	return nil
 }
 
+// Returns the articles of a language shown in the index, the tag pages and
+// the feeds, newest first. Drafts are never listed, so they are left out
+// before the listings are paginated.
+func ListedArticles(lang string) []ArticleData {
+	var listed []ArticleData
+	for _, article := range Badger.GetArticleIndex() {
+		if Site().Config.Layout(article.Layout).Listed && article.Lang == lang && !article.Draft {
+			listed = append(listed, article)
+		}
+	}
+	sort.Slice(listed, func(i, j int) bool {
+		return listed[i].Date.After(listed[j].Date)
+	})
+	return listed
+}
+
+// Returns the URL path of an article, which depends on its layout and the
+// permalink pattern of the site
+func ArticlePath(article ArticleData) string {
+	if Site().Config.Layout(article.Layout).Standalone {
+		return "/" + article.Slug
+	}
+	return expandPermalink(Site().Config.Permalink, article)
+}
+
 // Parses a .md file and returns the HTML and the raw markdown
-func GetArticleContent(filename string) (template.HTML, string, error) {
-	log.Printf("Loading article: %v", filename)
-	md, err := os.ReadFile(fmt.Sprintf("%v/articles/%v", os.Getenv("CONTENT_PATH"), filename))
+func GetArticleContent(filepath string) (template.HTML, string, error) {
+	Log("content").Debug().Str("file", filepath).Msg("Loading article")
+	md, err := os.ReadFile(filepath)
 	if err != nil {
 		return template.HTML(""), "", err
 	}
 
-	// Remove everything in the yaml metadata block
+	// Shortcodes are rendered apart, as goldmark would escape their HTML
+	expanded, shortcodes := ExpandShortcodes(md)
 
 	var htmlBuf bytes.Buffer
-	err = markdown.Convert(md, &htmlBuf)
+	err = markdown.Convert(expanded, &htmlBuf)
 	if err != nil {
 		return template.HTML(""), "", err
 	}
-	html := htmlBuf.Bytes()
+	html := ReplaceShortcodePlaceholders(htmlBuf.Bytes(), shortcodes)
 	return template.HTML(html), string(md), nil
 }
 
 // Loads an article from a markdown file and stores it in Redis
 func LoadArticle(article ArticleData) (err error) {
-	switch article.Slug {
-	case "about":
-		About.Slug = "about"
-		About.Data = article
-	default:
-		// Marshal the article data to JSON
-		articleJson, err := json.Marshal(article)
-		if err != nil {
-			return fmt.Errorf("error while marshalling article to JSON: %v", err)
-		}
-		Badger.Set("post_"+article.Slug, articleJson)
+	if err := Badger.SetArticle(article); err != nil {
+		return fmt.Errorf("error while storing article: %v", err)
 	}
+	BumpGeneration()
 
-	if article.NostrUrl == "" && article.Slug != "about" {
+	if article.NostrUrl == "" && Site().Config.Layout(article.Layout).Listed {
 		// Publish to Nostr
 		err = PublishArticleToNostr(article)
 		if err != nil {
-			log.Err(err).Msg("Error publishing article to Nostr")
+			Log("content").Err(err).Msg("Error publishing article to Nostr")
 		}
 	}
 	return nil
@@ -158,15 +201,22 @@ func LoadArticle(article ArticleData) (err error) {
 
 // Removes an article from Redis and the articles set
 func RemoveArticle(filename string) {
-	log.Printf("Removing article: %v", filename)
+	Log("content").Info().Str("file", filename).Msg("Removing article")
 	slug, _ := ParseFilePath(filename)
 	Badger.DeleteArticle(slug)
+	ClearLoadError(filename)
+	BumpGeneration()
 }
 
 // Returns an ArticleData struct from a markdown file
 func GetArticleFromFile(filepath string) (ArticleData, error) {
-	slug, extension := ParseFilePath(filepath)
-	filename := slug + extension
+	return getMarkdownFile(filepath, false)
+}
+
+// Reads the front matter and the content of an article or a page. Pages are
+// relaxed, none of their front matter fields is required.
+func getMarkdownFile(filepath string, relaxed bool) (ArticleData, error) {
+	slug, _ := ParseFilePath(filepath)
 
 	var article ArticleData
 	// Read the markdown file
@@ -175,85 +225,47 @@ func GetArticleFromFile(filepath string) (ArticleData, error) {
 		return article, err
 	}
 
-	var buf strings.Builder
-	pContext := parser.NewContext()
-	if err := markdown.Convert(content, &buf, parser.WithContext(pContext)); err != nil {
-		return article, err
+	fm, errs := ParseFrontMatter(filepath, content, relaxed)
+	if len(errs) > 0 {
+		return article, errs
 	}
 
-	metadata := meta.Get(pContext)
-	if filepath == fmt.Sprintf("%v/articles/about.md", os.Getenv("CONTENT_PATH")) {
-		article = ArticleData{}
-	} else {
-		// Handle drafts
-		draftValue, exists := metadata["Draft"]
-		if !exists {
-			log.Err(err).Msgf("Could not parse draft value for %v, considering draft", filepath)
-			return article, errors.New("could not parse draft value")
-		}
-
-		var draft bool
-		switch articleDraft := draftValue.(type) {
-		case bool:
-			draft = articleDraft
-		case string:
-			if isDraft, err := strconv.ParseBool(articleDraft); err == nil && isDraft {
-				draft = true
-			} else if err != nil {
-				log.Warn().Msgf("Could not parse draft value for %v, considering draft", filepath)
-				draft = true
-			}
-		default:
-			log.Err(err).Msgf("Could not parse draft value for %v, considering draft", filepath)
-			draft = true
-		}
-
-		// Parse date
-		dateString := GetMapStringValue(metadata, "Date")
-		date, err := time.Parse("2006-01-02 15:04", dateString)
-		if err != nil {
-			date, err = time.Parse("2006-01-02", dateString)
-			if err != nil {
-				log.Err(err).Msgf("Could not parse date for %v, using current time", filepath)
-				date = time.Now()
-			}
-		}
-
-		image := GetMapStringValue(metadata, "Image")
-		if image != "" && strings.HasPrefix(image, "/") {
-			image = fmt.Sprintf("%v%v", Blogo.Url, image)
-		}
-
-		// Fill article Data
-		article = ArticleData{
-			Date:     date,
-			Draft:    draft,
-			Image:    image,
-			Title:    GetMapStringValue(metadata, "Title"),
-			Author:   GetMapStringValue(metadata, "Author"),
-			Summary:  GetMapStringValue(metadata, "Summary"),
-			Layout:   GetMapStringValue(metadata, "Layout"),
-			NostrUrl: GetMapStringValue(metadata, "NostrUrl"),
-		}
+	image := fm.Image
+	if image != "" && strings.HasPrefix(image, "/") {
+		image = fmt.Sprintf("%v%v", Site().Config.Url, image)
+	}
 
-		if tags, ok := metadata["Tags"].([]interface{}); ok {
-			for _, tag := range tags {
-				if strTag, ok := tag.(string); ok {
-					article.Tags = append(article.Tags, strTag)
-				} else {
-					log.Warn().Msgf("Could not parse tag %v for %v", tag, filepath)
-				}
-			}
-		}
+	// Fill article Data
+	article = ArticleData{
+		Date:     fm.Date,
+		Draft:    fm.Draft,
+		Image:    image,
+		Title:    fm.Title,
+		Author:   fm.Author,
+		Summary:  fm.Summary,
+		Tags:     fm.Tags,
+		Aliases:  fm.Aliases,
+		Layout:   fm.Layout,
+		Link:     fm.Link,
+		Menu:     fm.Menu,
+		Weight:   fm.Weight,
+		Lang:     fm.Lang,
+		NostrUrl: fm.NostrUrl,
+
+		TranslationKey: fm.TranslationKey,
+	}
+	if article.Lang == "" {
+		article.Lang = Site().Config.Language
 	}
 
-	html, md, err := GetArticleContent(fmt.Sprintf("%v", filename))
+	html, md, err := GetArticleContent(filepath)
 	if err != nil {
 		return ArticleData{}, err
 	}
 
 	article.Html = html
 	article.Md = md
+	article.StyleHashes = StyleHashes(string(html))
 
 	article.Slug = slug
 
@@ -262,11 +274,11 @@ func GetArticleFromFile(filepath string) (ArticleData, error) {
 
 // Adds or modifies metadata in a markdown file.md
 func AddMetadataToFile(filename, key, value string) error {
-	filePath := fmt.Sprintf("%v/articles/%v", os.Getenv("CONTENT_PATH"), filename)
+	filePath := fmt.Sprintf("%v/articles/%v", Site().Config.ContentPath, filename)
 	// Read the markdown file
 	markdown, err := os.ReadFile(filePath)
 	if err != nil {
-		log.Error().Msgf("Could not read markdown file %v", filePath)
+		Log("content").Error().Msgf("Could not read markdown file %v", filePath)
 		return err
 	}
 
@@ -280,7 +292,7 @@ func AddMetadataToFile(filename, key, value string) error {
 	metadata := make(map[string]interface{})
 	err = yaml.Unmarshal([]byte(sections[1]), &metadata)
 	if err != nil {
-		log.Error().Msgf("Could not unmarshal YAML data for file %v", filePath)
+		Log("content").Error().Msgf("Could not unmarshal YAML data for file %v", filePath)
 		return err
 	}
 
@@ -290,7 +302,7 @@ func AddMetadataToFile(filename, key, value string) error {
 	// Rebuild the YAML
 	yamlData, err := yaml.Marshal(metadata)
 	if err != nil {
-		log.Error().Msgf("Could not marshal YAML data for file %v", filePath)
+		Log("content").Error().Msgf("Could not marshal YAML data for file %v", filePath)
 		return err
 	}
 
@@ -304,13 +316,13 @@ func AddMetadataToFile(filename, key, value string) error {
 	// Write the updated markdown to the file
 	err = os.WriteFile(filePath, buffer.Bytes(), 0644)
 	if err != nil {
-		log.Error().Msgf("Could not write updated markdown to file %v", filePath)
+		Log("content").Error().Msgf("Could not write updated markdown to file %v", filePath)
 		return err
 	}
 
-	article, err := GetArticleFromFile(path.Join(os.Getenv("CONTENT_PATH"), "/articles", filename))
+	article, err := GetArticleFromFile(path.Join(Site().Config.ContentPath, "/articles", filename))
 	if err != nil {
-		log.Error().Msgf("Could not get article from file %v", filePath)
+		Log("content").Error().Msgf("Could not get article from file %v", filePath)
 		return err
 	}
 	LoadArticle(article)
@@ -324,7 +336,7 @@ func CreateArticleTemplate(name string) error {
 	name = replacer.Replace(name)
 	name = strings.ToLower(name)
 
-	contentPath := os.Getenv("CONTENT_PATH")
+	contentPath := Site().Config.ContentPath
 	filePath := fmt.Sprintf("%s/articles/%s.md", contentPath, name)
 
 	// Check if the file already exists
@@ -337,7 +349,7 @@ func CreateArticleTemplate(name string) error {
 		"Title":   strings.Replace(name, "-", " ", -1),
 		"Summary": "A brief summary of what this post is about.",
 		"Tags":    []string{"tag1", "tag2"},
-		"Date":    time.Now().Format("2006-01-02 15:04"),
+		"Date":    time.Now().In(Site().Config.Location).Format("2006-01-02 15:04"),
 		"Image":   "https://picsum.photos/1920/1080",
 		"Layout":  "post",
 		"Draft":   true,
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestLoadArticlesRemovesDeleted(t *testing.T) {
+	withBadger(t)
+	dir := withContent(t, map[string]string{
+		"articles/kept.md":    "---\nTitle: Kept\nDate: 2024-01-01\nDraft: false\n---\nKept",
+		"articles/removed.md": "---\nTitle: Removed\nDate: 2024-01-02\nDraft: false\n---\nRemoved",
+	})
+	if err := InitTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadArticles(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Badger.DeleteArticle("kept") })
+
+	var out bytes.Buffer
+	logger := log.Logger
+	t.Cleanup(func() { log.Logger = logger })
+	log.Logger = zerolog.New(&out)
+
+	os.Remove(filepath.Join(dir, "articles", "removed.md"))
+	if err := LoadArticles(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Badger.GetIndexedArticle("removed"); ok {
+		t.Error("the removed article is still loaded")
+	}
+	if _, ok := Badger.GetIndexedArticle("kept"); !ok {
+		t.Error("the kept article was removed")
+	}
+
+	// The log lists the removed articles, not the loaded ones
+	for _, line := range bytes.Split(out.Bytes(), []byte("\n")) {
+		var entry struct {
+			Left []string `json:"left"`
+		}
+		if json.Unmarshal(line, &entry) != nil || entry.Left == nil {
+			continue
+		}
+		if !StringInSlice("removed", entry.Left) || StringInSlice("kept", entry.Left) {
+			t.Errorf("logged left = %v, want the removed article", entry.Left)
+		}
+		return
+	}
+	t.Errorf("no removal was logged: %q", out.String())
+}
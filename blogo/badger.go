@@ -2,7 +2,10 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/rs/zerolog/log"
 
@@ -38,7 +41,7 @@ func (d *Database) GetAllArticleSlugs() ([]string, error) {
 		for it.Rewind(); it.Valid(); it.Next() {
 			item := it.Item()
 			key := item.Key()
-			keys = append(keys, strings.Trim(string(key), "post_"))
+			keys = append(keys, strings.TrimPrefix(string(key), "post_"))
 		}
 		return nil
 	})
@@ -78,7 +81,7 @@ func (d *Database) GetAllArticles() []ArticleData {
 		var article ArticleData
 		err := json.Unmarshal(ab, &article)
 		if err != nil {
-			log.Error().Err(err).Msg("Error unmarshalling article from Badger:")
+			Log("content").Error().Err(err).Msg("Error unmarshalling article from Badger:")
 			continue
 		}
 		articles = append(articles, article)
@@ -87,9 +90,87 @@ func (d *Database) GetAllArticles() []ArticleData {
 }
 
 func (d *Database) DeleteArticle(key string) error {
+	articleIndex.Lock()
+	delete(articleIndex.articles, key)
+	articleIndex.Unlock()
 	return d.Delete("post_" + key)
 }
 
+// The metadata of the stored articles, without their markdown and HTML, so
+// listing them does not decode every article
+var articleIndex = struct {
+	sync.RWMutex
+	articles map[string]ArticleData
+}{articles: map[string]ArticleData{}}
+
+// Stores an article and adds it to the article index
+func (d *Database) SetArticle(article ArticleData) error {
+	articleJson, err := json.Marshal(article)
+	if err != nil {
+		return fmt.Errorf("error while marshalling article to JSON: %v", err)
+	}
+	if err := d.Set("post_"+article.Slug, articleJson); err != nil {
+		return err
+	}
+
+	article.Md, article.Html = "", ""
+	articleIndex.Lock()
+	articleIndex.articles[article.Slug] = article
+	articleIndex.Unlock()
+	return nil
+}
+
+// Returns the metadata of all the articles, sorted by slug. Their Md and
+// Html are empty, get the full article with GetPostBySlug.
+func (d *Database) GetArticleIndex() []ArticleData {
+	articleIndex.RLock()
+	defer articleIndex.RUnlock()
+	articles := make([]ArticleData, 0, len(articleIndex.articles))
+	for _, article := range articleIndex.articles {
+		articles = append(articles, article)
+	}
+	sort.Slice(articles, func(i, j int) bool {
+		return articles[i].Slug < articles[j].Slug
+	})
+	return articles
+}
+
+// Returns the metadata of an article from the index, without decoding the
+// stored article. Its Md and Html are empty.
+func (d *Database) GetIndexedArticle(slug string) (ArticleData, bool) {
+	articleIndex.RLock()
+	defer articleIndex.RUnlock()
+	article, ok := articleIndex.articles[slug]
+	return article, ok
+}
+
+func (d *Database) GetPageBySlug(slug string) (ArticleData, error) {
+	var page ArticleData
+	value, err := d.Get("page_" + slug)
+	if err != nil {
+		return page, err
+	}
+	err = json.Unmarshal(value, &page)
+	return page, err
+}
+
+func (d *Database) GetAllPages() []ArticleData {
+	var pages []ArticleData
+	for _, pb := range d.GetValuesWithPrefix("page_") {
+		var page ArticleData
+		if err := json.Unmarshal(pb, &page); err != nil {
+			Log("content").Error().Err(err).Msg("Error unmarshalling page from Badger:")
+			continue
+		}
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+func (d *Database) DeletePage(slug string) error {
+	return d.Delete("page_" + slug)
+}
+
 // GENERIC FUNCTIONS
 
 func (d *Database) Set(key string, value []byte) error {
@@ -182,3 +263,22 @@ func (d *Database) GetValuesWithPrefix(prefix string) [][]byte {
 	})
 	return values
 }
+
+// Returns the number of keys and the estimated size of the data, which
+// Size() does not report for an in-memory database
+func (d *Database) Stats() (int, int64) {
+	keys, size := 0, int64(0)
+	d.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			keys++
+			size += it.Item().EstimatedSize()
+		}
+		return nil
+	})
+	return keys, size
+}
@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestArticleIndex(t *testing.T) {
+	withBadger(t)
+	article := ArticleData{Slug: "indexed", Title: "Indexed", Md: "# Indexed", Html: "<h1>Indexed</h1>"}
+	if err := Badger.SetArticle(article); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Badger.DeleteArticle(article.Slug) })
+
+	var indexed *ArticleData
+	index := Badger.GetArticleIndex()
+	for i := range index {
+		if index[i].Slug == article.Slug {
+			indexed = &index[i]
+		}
+	}
+	if indexed == nil || indexed.Title != "Indexed" || indexed.Md != "" || indexed.Html != "" {
+		t.Fatalf("index entry %+v, want the metadata without the body", indexed)
+	}
+
+	if got, ok := Badger.GetIndexedArticle(article.Slug); !ok || got.Title != "Indexed" || got.Html != "" {
+		t.Errorf("GetIndexedArticle = %+v, %v, want the metadata", got, ok)
+	}
+
+	// The stored article keeps its body
+	if stored, err := Badger.GetPostBySlug(article.Slug); err != nil || stored.Md != article.Md {
+		t.Errorf("GetPostBySlug = %+v, %v", stored, err)
+	}
+
+	Badger.DeleteArticle(article.Slug)
+	for _, a := range Badger.GetArticleIndex() {
+		if a.Slug == article.Slug {
+			t.Error("the deleted article is still in the index")
+		}
+	}
+	if _, ok := Badger.GetIndexedArticle(article.Slug); ok {
+		t.Error("GetIndexedArticle found the deleted article")
+	}
+}
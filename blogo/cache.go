@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Cache-Control headers by kind of route, read from the `cache` section of
+// the config file. An empty value sends no Cache-Control header.
+type CacheConfig struct {
+	// The index, tag and archive pages
+	Listings string `yaml:"listings" toml:"listings"`
+	// Posts, pages and their raw markdown
+	Articles string `yaml:"articles" toml:"articles"`
+	Feeds    string `yaml:"feeds" toml:"feeds"`
+	// Static files without a fingerprint in their URL
+	Static string `yaml:"static" toml:"static"`
+}
+
+// Pages are revalidated on every visit, which costs a 304 when nothing
+// changed, so a new post shows up at once
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{
+		Listings: "public, no-cache",
+		Articles: "public, no-cache",
+		Feeds:    "public, max-age=300",
+		Static:   "public, max-age=86400",
+	}
+}
+
+// The content generation, bumped every time an article, a page, the feeds,
+// the templates or the config change. Every response rendered from the same
+// generation is the same, so it identifies the version of the whole site.
+var generation atomic.Uint64
+
+// When the content generation last changed
+var generationTime atomic.Int64
+
+func init() {
+	// The content may have changed while Blogo was stopped, so the
+	// generations of a process never repeat the ones of a previous one
+	now := time.Now()
+	generation.Store(uint64(now.UnixNano()))
+	generationTime.Store(now.Unix())
+}
+
+// Marks the content as changed, so clients fetch the new responses
+func BumpGeneration() {
+	generation.Add(1)
+	generationTime.Store(time.Now().Unix())
+}
+
+// The Cache-Control headers of a kind of route
+type CacheKind int
+
+const (
+	CacheListings CacheKind = iota
+	CacheArticles
+	CacheFeeds
+	CacheStatic
+)
+
+func (k CacheKind) control() string {
+	cfg := Site().Config.Cache
+	switch k {
+	case CacheArticles:
+		return cfg.Articles
+	case CacheFeeds:
+		return cfg.Feeds
+	case CacheStatic:
+		return cfg.Static
+	}
+	return cfg.Listings
+}
+
+// Adds an ETag, a Last-Modified and a Cache-Control header to the responses
+// of a handler, and answers conditional requests for an unchanged URL with a
+// 304 without running it.
+func Cached(kind CacheKind, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h := fnv.New64a()
+		h.Write([]byte(r.URL.RequestURI()))
+		etag := fmt.Sprintf(`"%x-%x"`, generation.Load(), h.Sum64())
+		modified := time.Unix(generationTime.Load(), 0)
+
+		setCacheHeaders(w, kind.control(), etag, modified)
+		if notModified(r, etag, modified) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		next(&cacheWriter{ResponseWriter: w}, r)
+	}
+}
+
+func setCacheHeaders(w http.ResponseWriter, control, etag string, modified time.Time) {
+	if Site().Config.Dev {
+		control = "no-cache"
+	}
+	if control != "" {
+		w.Header().Set("Cache-Control", control)
+	}
+	w.Header().Set("ETag", etag)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// Reports whether the client already has the current version of a response
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || decodedETag(strings.TrimPrefix(candidate, "W/")) == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.IsZero() {
+		return !modified.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+// Drops the validators of error responses and redirects, which must not be
+// cached as the page itself
+type cacheWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *cacheWriter) WriteHeader(code int) {
+	if !w.wroteHeader && code != http.StatusOK && code != http.StatusNotModified {
+		w.Header().Del("ETag")
+		w.Header().Del("Last-Modified")
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *cacheWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// The listing pages and feeds rendered for the current content generation,
+// by path
+var renderCache = struct {
+	sync.RWMutex
+	generation uint64
+	pages      map[string]renderedPage
+}{pages: map[string]renderedPage{}}
+
+// Bounds the memory used by the render cache
+const renderCacheSize = 1000
+
+type renderedPage struct {
+	contentType string
+	body        []byte
+}
+
+// Serves a listing page or a feed from the render cache, rendering it on a
+// miss. The cache is emptied whenever the content generation changes, and
+// only 200 responses are cached.
+func RenderCached(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next(w, r)
+			return
+		}
+
+		key := r.URL.Path
+		gen := generation.Load()
+		renderCache.RLock()
+		page, ok := renderCache.pages[key]
+		ok = ok && renderCache.generation == gen
+		renderCache.RUnlock()
+		if ok {
+			if page.contentType != "" {
+				w.Header().Set("Content-Type", page.contentType)
+			}
+			w.Write(page.body)
+			return
+		}
+
+		rec := &renderRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+		if rec.status != http.StatusOK {
+			return
+		}
+
+		renderCache.Lock()
+		defer renderCache.Unlock()
+		// Never store a page rendered from content that already changed
+		if generation.Load() != gen {
+			return
+		}
+		if renderCache.generation != gen {
+			renderCache.generation = gen
+			renderCache.pages = map[string]renderedPage{}
+		}
+		if len(renderCache.pages) < renderCacheSize {
+			renderCache.pages[key] = renderedPage{contentType: w.Header().Get("Content-Type"), body: rec.body.Bytes()}
+		}
+	}
+}
+
+// Keeps a copy of the response written by a handler
+type renderRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *renderRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *renderRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// Content hashes of the static files, by path
+var fingerprints sync.Map
+
+// Forgets the content hashes of the static files after they change
+func ResetFingerprints() {
+	fingerprints.Range(func(key, _ interface{}) bool {
+		fingerprints.Delete(key)
+		return true
+	})
+}
+
+// Returns a short hash of the content of a static file, or an empty string
+// if the file does not exist
+func Fingerprint(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if hash, ok := fingerprints.Load(name); ok {
+		return hash.(string)
+	}
+
+	site := Site()
+	var content []byte
+	if name == "chroma.css" {
+		content = site.ChromaCss
+	} else {
+		var err error
+		if content, err = fs.ReadFile(site.Theme.Static(), name); err != nil {
+			return ""
+		}
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256(content))[:12]
+	fingerprints.Store(name, hash)
+	return hash
+}
+
+// Returns the URL of a static file with its fingerprint, like
+// /static/css/style.css?v=1a2b3c4d5e6f. The URL changes with the content of
+// the file, so browsers can cache it forever.
+func StaticURL(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if hash := Fingerprint(name); hash != "" {
+		return "/static/" + name + "?v=" + hash
+	}
+	return "/static/" + name
+}
+
+// Caches the static files by their content. Fingerprinted URLs with the
+// current hash of the file never change, and are cached forever.
+func CachedStatic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hash := Fingerprint(r.URL.Path)
+		if hash == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		control := CacheStatic.control()
+		if r.URL.Query().Get("v") == hash {
+			control = "public, max-age=31536000, immutable"
+		}
+		etag := `"` + hash + `"`
+		setCacheHeaders(w, control, etag, time.Time{})
+		if notModified(r, etag, time.Time{}) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNotModified(t *testing.T) {
+	etag := `"1a-2b"`
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    bool
+	}{
+		{"no validators", http.MethodGet, nil, false},
+		{"same etag", http.MethodGet, map[string]string{"If-None-Match": etag}, true},
+		{"head", http.MethodHead, map[string]string{"If-None-Match": etag}, true},
+		{"post", http.MethodPost, map[string]string{"If-None-Match": etag}, false},
+		{"other etag", http.MethodGet, map[string]string{"If-None-Match": `"1a-3c"`}, false},
+		{"weak etag", http.MethodGet, map[string]string{"If-None-Match": "W/" + etag}, true},
+		{"list of etags", http.MethodGet, map[string]string{"If-None-Match": `"x", ` + etag}, true},
+		{"any etag", http.MethodGet, map[string]string{"If-None-Match": "*"}, true},
+		{"compressed etag", http.MethodGet, map[string]string{"If-None-Match": `"1a-2b-br"`}, true},
+		{"gzip etag", http.MethodGet, map[string]string{"If-None-Match": `W/"1a-2b-gzip"`}, true},
+		{"etag wins over date", http.MethodGet, map[string]string{
+			"If-None-Match":     `"old"`,
+			"If-Modified-Since": modified.Format(http.TimeFormat),
+		}, false},
+		{"not modified since", http.MethodGet, map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, true},
+		{"modified since", http.MethodGet, map[string]string{"If-Modified-Since": modified.Add(-time.Hour).Format(http.TimeFormat)}, false},
+		{"invalid date", http.MethodGet, map[string]string{"If-Modified-Since": "yesterday"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			if got := notModified(r, etag, modified); got != tt.want {
+				t.Errorf("notModified = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodedETag(t *testing.T) {
+	tests := map[string]string{
+		`"1a-2b"`:      `"1a-2b"`,
+		`"1a-2b-br"`:   `"1a-2b"`,
+		`"1a-2b-gzip"`: `"1a-2b"`,
+		`"1a-2b-zstd"`: `"1a-2b-zstd"`,
+	}
+	for etag, want := range tests {
+		if got := decodedETag(etag); got != want {
+			t.Errorf("decodedETag(%v) = %v, want %v", etag, got, want)
+		}
+	}
+}
+
+func TestCached(t *testing.T) {
+	withConfig(t, func(c *Config) {
+		c.Dev = false
+		c.Cache = DefaultCacheConfig()
+	})
+
+	calls := 0
+	handler := Cached(CacheFeeds, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("feed"))
+	})
+	get := func(path, etag string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	first := get("/rss", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Body.String() != "feed" {
+		t.Fatalf("first request: %v %q, ETag %q", first.Code, first.Body.String(), etag)
+	}
+	if got := first.Header().Get("Cache-Control"); got != DefaultCacheConfig().Feeds {
+		t.Errorf("Cache-Control = %q, want the feeds one", got)
+	}
+	if first.Header().Get("Last-Modified") == "" {
+		t.Error("no Last-Modified header")
+	}
+
+	// The ETag belongs to the URL
+	if other := get("/atom", "").Header().Get("ETag"); other == etag {
+		t.Errorf("/rss and /atom have the same ETag %v", etag)
+	}
+
+	calls = 0
+	if w := get("/rss", etag); w.Code != http.StatusNotModified || calls != 0 {
+		t.Errorf("unchanged content: %v with %v calls, want a 304 without calling the handler", w.Code, calls)
+	}
+
+	BumpGeneration()
+	w := get("/rss", etag)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("changed content: %v with ETag %v, want a 200 with a new ETag", w.Code, w.Header().Get("ETag"))
+	}
+
+	// Errors are not cached as the page
+	w = get("/missing", "")
+	if w.Code != http.StatusNotFound || w.Header().Get("ETag") != "" || w.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("404 sent ETag %q and Cache-Control %q", w.Header().Get("ETag"), w.Header().Get("Cache-Control"))
+	}
+}
+
+func TestCachedDevMode(t *testing.T) {
+	withConfig(t, func(c *Config) {
+		c.Dev = true
+		c.Cache = DefaultCacheConfig()
+	})
+	w := httptest.NewRecorder()
+	Cached(CacheFeeds, func(w http.ResponseWriter, r *http.Request) {})(w, httptest.NewRequest(http.MethodGet, "/rss", nil))
+	if got := w.Header().Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("Cache-Control in dev mode = %q, want no-cache", got)
+	}
+}
+
+func TestGenerationIsSeededPerProcess(t *testing.T) {
+	// A process started later must not reuse the ETags of a previous one,
+	// which started counting from the same value
+	if generation.Load() < uint64(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano()) {
+		t.Errorf("generation starts at %v, not at the boot time", generation.Load())
+	}
+}
+
+func TestRenderCached(t *testing.T) {
+	calls := 0
+	handler := RenderCached(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprintf(w, "render %v", calls)
+	})
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	BumpGeneration()
+	get("/rss")
+	w := get("/rss")
+	if calls != 1 || w.Body.String() != "render 1" || w.Header().Get("Content-Type") != "application/rss+xml" {
+		t.Errorf("second request rendered %v times, got %q with %q", calls, w.Body.String(), w.Header().Get("Content-Type"))
+	}
+
+	BumpGeneration()
+	if w := get("/rss"); w.Body.String() != "render 2" {
+		t.Errorf("after a content change got %q, want a new render", w.Body.String())
+	}
+
+	get("/missing")
+	get("/missing")
+	if calls != 4 {
+		t.Errorf("rendered %v times, want the 404 rendered every time", calls)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Content types worth compressing. Images, fonts and the like are already
+// compressed.
+var compressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/xml",
+	"application/rss+xml",
+	"application/atom+xml",
+	"application/javascript",
+	"image/svg+xml",
+}
+
+// Extensions of the precompressed files, by encoding
+var encodingExts = map[string]string{
+	"br":   ".br",
+	"gzip": ".gz",
+}
+
+// Returns the encoding to use for a request, br or gzip, or an empty string
+// if the client accepts neither
+func negotiateEncoding(r *http.Request) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := encodingExts[name]; !ok {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, _ = strconv.ParseFloat(value, 64)
+		}
+		// Brotli wins ties, it compresses better
+		if q > bestQ || (q == bestQ && q > 0 && name == "br") {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+func compressible(contentType string) bool {
+	for _, prefix := range compressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func newEncoder(w io.Writer, encoding string) io.WriteCloser {
+	if encoding == "br" {
+		return brotli.NewWriterLevel(w, brotli.DefaultCompression)
+	}
+	gz, _ := gzip.NewWriterLevel(w, gzip.DefaultCompression)
+	return gz
+}
+
+// Compresses the responses with brotli or gzip, depending on what the client
+// accepts. Responses that are already encoded, like the precompressed pages,
+// are sent as they are.
+func Compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(r)
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding, status: http.StatusOK}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// Holds the status code until the first write, when the content type is
+// known and the response can be compressed
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	status      int
+	wroteHeader bool
+	encoder     io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.status = code
+	if code != http.StatusOK {
+		cw.start(nil)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.start(b)
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *compressWriter) start(body []byte) {
+	cw.wroteHeader = true
+	h := cw.Header()
+	if body != nil && cw.status == http.StatusOK && h.Get("Content-Encoding") == "" && h.Get("Content-Range") == "" {
+		contentType := h.Get("Content-Type")
+		if contentType == "" {
+			contentType = http.DetectContentType(body)
+			h.Set("Content-Type", contentType)
+		}
+		if compressible(contentType) {
+			h.Set("Content-Encoding", cw.encoding)
+			h.Del("Content-Length")
+			h.Set("ETag", encodedETag(h.Get("ETag"), cw.encoding))
+			cw.encoder = newEncoder(cw.ResponseWriter, cw.encoding)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+}
+
+func (cw *compressWriter) Close() {
+	if !cw.wroteHeader {
+		cw.start(nil)
+	}
+	if cw.encoder != nil {
+		cw.encoder.Close()
+	}
+}
+
+// Compressed responses are a different representation, with its own strong
+// ETag: "abc" becomes "abc-br"
+func encodedETag(etag, encoding string) string {
+	if !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+	return strings.TrimSuffix(etag, `"`) + "-" + encoding + `"`
+}
+
+// Returns an ETag sent back by a client without the encoding suffix
+func decodedETag(etag string) string {
+	for encoding := range encodingExts {
+		if strings.HasSuffix(etag, "-"+encoding+`"`) {
+			return strings.TrimSuffix(etag, "-"+encoding+`"`) + `"`
+		}
+	}
+	return etag
+}
+
+// Writes the brotli and gzip versions of a generated file next to it, like
+// post.html.br and post.html.gz
+func writePrecompressed(filePath string, content []byte) error {
+	for encoding, ext := range encodingExts {
+		var buf bytes.Buffer
+		encoder := newEncoder(&buf, encoding)
+		encoder.Write(content)
+		if err := encoder.Close(); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filePath+ext, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Removes a generated file and its compressed versions
+func removeGenerated(filePath string) error {
+	err := os.Remove(filePath)
+	for _, ext := range encodingExts {
+		os.Remove(filePath + ext)
+	}
+	return err
+}
+
+// Serves a generated HTML file, or its precompressed version when the client
+// accepts it
+func serveGenerated(w http.ResponseWriter, r *http.Request, filePath string) {
+	if _, err := os.Stat(filePath); err != nil {
+		NotFound(w, r)
+		return
+	}
+	if encoding := negotiateEncoding(r); encoding != "" {
+		compressed := filePath + encodingExts[encoding]
+		if _, err := os.Stat(compressed); err == nil {
+			h := w.Header()
+			h.Set("Content-Type", "text/html; charset=utf-8")
+			h.Set("Content-Encoding", encoding)
+			if etag := h.Get("ETag"); etag != "" {
+				h.Set("ETag", encodedETag(etag, encoding))
+			}
+			http.ServeFile(w, r, compressed)
+			return
+		}
+	}
+	http.ServeFile(w, r, filePath)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"br", "br"},
+		{"gzip, deflate, br", "br"},
+		{"GZIP", "gzip"},
+		{"br;q=0.5, gzip", "gzip"},
+		{"gzip;q=0.8, br;q=0.8", "br"},
+		{"br;q=0, gzip;q=0", ""},
+		{"br;q=0, gzip", "gzip"},
+		{"deflate, zstd", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", tt.accept)
+		if got := negotiateEncoding(r); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestEncodedETag(t *testing.T) {
+	tests := []struct{ etag, encoding, want string }{
+		{`"1a-2b"`, "br", `"1a-2b-br"`},
+		{`"1a-2b"`, "gzip", `"1a-2b-gzip"`},
+		{"", "br", ""},
+	}
+	for _, tt := range tests {
+		if got := encodedETag(tt.etag, tt.encoding); got != tt.want {
+			t.Errorf("encodedETag(%q, %v) = %q, want %q", tt.etag, tt.encoding, got, tt.want)
+		}
+		if tt.etag != "" && decodedETag(encodedETag(tt.etag, tt.encoding)) != tt.etag {
+			t.Errorf("decodedETag does not undo encodedETag for %v", tt.etag)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	body := strings.Repeat("<p>Hello, compressed world!</p>\n", 50)
+	handler := Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"1a-2b"`)
+		switch r.URL.Path {
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		}
+		io.WriteString(w, body)
+	}))
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("Accept-Encoding", accept)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("/", "gzip")
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("ETag") != `"1a-2b-gzip"` {
+		t.Fatalf("Content-Encoding %q, ETag %q", w.Header().Get("Content-Encoding"), w.Header().Get("ETag"))
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded, _ := io.ReadAll(gz); string(decoded) != body {
+		t.Errorf("decoded body is %q", decoded)
+	}
+	if !strings.Contains(w.Header().Get("Vary"), "Accept-Encoding") {
+		t.Error("no Vary: Accept-Encoding header")
+	}
+
+	for _, tt := range []struct{ name, path, accept string }{
+		{"not accepted", "/", ""},
+		{"already compressed type", "/image", "br"},
+		{"error response", "/missing", "br"},
+	} {
+		w := get(tt.path, tt.accept)
+		if w.Header().Get("Content-Encoding") != "" || w.Body.String() != body {
+			t.Errorf("%v: sent with Content-Encoding %q", tt.name, w.Header().Get("Content-Encoding"))
+		}
+	}
+}
+
+func TestRemoveGenerated(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "post.html")
+	if err := os.WriteFile(file, []byte("<p>post</p>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writePrecompressed(file, []byte("<p>post</p>")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := removeGenerated(file); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("left %v behind", entries)
+	}
+}
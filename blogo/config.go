@@ -1,3 +1,408 @@
 package main
 
-var Blogo Config
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v2"
+)
+
+// The files the config was loaded from and the command line overrides, kept
+// so the config can be rebuilt when one of the files changes
+var ConfigFile string
+var EnvFile string
+var configOverrides = func(*Config) {}
+
+// Config file names looked up in the content folder, in order
+var configFileNames = []string{"blogo.yaml", "blogo.yml", "blogo.toml"}
+
+func DefaultConfig() Config {
+	return Config{
+		Title:       "Blogo",
+		Description: "Welcome to my Blogo 🎈",
+		Url:         "http://localhost:3000",
+		Keywords:    "blog, blogo",
+		Timezone:    "UTC",
+		Location:    time.UTC,
+		Language:    "en",
+		ContentPath: ".",
+		Port:        3000,
+		PageSize:    10,
+		Permalink:   LegacyPermalink,
+		Markdown:    DefaultMarkdownConfig(),
+		Cache:       DefaultCacheConfig(),
+		Security:    DefaultSecurityConfig(),
+		Log:         DefaultLogConfig(),
+		Server: ServerConfig{
+			ReadTimeout:     Duration(15 * time.Second),
+			WriteTimeout:    Duration(30 * time.Second),
+			IdleTimeout:     Duration(2 * time.Minute),
+			ShutdownTimeout: Duration(15 * time.Second),
+		},
+	}
+}
+
+// Returns the config file to use: the given one, or the first default config
+// file found in the content folder. Returns an empty string if there is none.
+func FindConfigFile(file, contentPath string) string {
+	if file != "" {
+		return file
+	}
+	for _, name := range configFileNames {
+		candidate := path.Join(contentPath, name)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// Loads the config from the config file and the environment, applies the
+// command line overrides and validates the result.
+func ResolveConfig() (Config, error) {
+	cfg, err := LoadConfig(ConfigFile)
+	if err != nil {
+		return cfg, err
+	}
+	configOverrides(&cfg)
+	if err := cfg.Validate(); err != nil {
+		return cfg, fmt.Errorf("invalid configuration:\n%v", err)
+	}
+	return cfg, nil
+}
+
+// Reloads the config after the config file or the .env file changed. The
+// running config is kept if the new one is not valid.
+func ReloadConfig() error {
+	// Overload, as the variables from the previous .env are already set
+	if err := godotenv.Overload(EnvFile); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading %v: %v", EnvFile, err)
+	}
+	cfg, err := ResolveConfig()
+	if err != nil {
+		return err
+	}
+
+	// The server is already listening, routing and watching the content folder
+	running := Site().Config
+	if cfg.Port != running.Port || cfg.ContentPath != running.ContentPath || cfg.Permalink != running.Permalink {
+		log.Warn().Msg("Changes to the port, the content path or the permalink need a restart")
+		cfg.Port, cfg.ContentPath, cfg.Permalink = running.Port, running.ContentPath, running.Permalink
+	}
+	// The logger is shared by every request, only its level can change
+	if cfg.Log.Format != running.Log.Format {
+		log.Warn().Msg("Changes to the log format need a restart")
+		cfg.Log.Format = running.Log.Format
+	}
+	nostrChanged := !reflect.DeepEqual(cfg.Nostr, running.Nostr)
+
+	UpdateSite(func(s *siteState) { s.Config = cfg })
+	SetLogLevel()
+	LogSettings()
+	BumpGeneration()
+	if nostrChanged && cfg.Nostr.Publish {
+		if err := InitNostr(); err != nil {
+			log.Error().Err(err).Msg("Error initializing nostr:")
+		}
+	}
+	return nil
+}
+
+// Loads the configuration from the defaults, the config file and the
+// environment, in increasing order of precedence. Command line flags are
+// applied on top by the caller.
+func LoadConfig(file string) (Config, error) {
+	cfg := DefaultConfig()
+	if file != "" {
+		if err := cfg.loadFile(file); err != nil {
+			return cfg, err
+		}
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(file string) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %v", err)
+	}
+
+	switch filepath.Ext(file) {
+	case ".toml":
+		meta, err := toml.Decode(string(content), c)
+		if err != nil {
+			return fmt.Errorf("error parsing config file %v: %v", file, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("error parsing config file %v: unknown keys %v", file, undecoded)
+		}
+	case ".yaml", ".yml":
+		if err := yaml.UnmarshalStrict(content, c); err != nil {
+			return fmt.Errorf("error parsing config file %v: %v", file, err)
+		}
+	default:
+		return fmt.Errorf("unsupported config file format %v, use .yaml or .toml", file)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	var errs []error
+	stringVars := map[string]*string{
+		"BLOGO_TITLE":      &c.Title,
+		"BLOGO_URL":        &c.Url,
+		"BLOGO_KEYWORDS":   &c.Keywords,
+		"BLOGO_ANALYTICS":  &c.Analytics,
+		"TIMEZONE":         &c.Timezone,
+		"CONTENT_PATH":     &c.ContentPath,
+		"BLOGO_THEME":      &c.Theme,
+		"BLOGO_LANGUAGE":   &c.Language,
+		"BLOGO_PERMALINK":  &c.Permalink,
+		"BLOGO_LOG_FORMAT": &c.Log.Format,
+		"BLOGO_LOG_LEVEL":  &c.Log.Level,
+		"NOSTR_NSEC":       &c.Nostr.Nsec,
+	}
+	for name, field := range stringVars {
+		if value := os.Getenv(name); value != "" {
+			*field = value
+		}
+	}
+
+	// "false" disables the description
+	if value := os.Getenv("BLOGO_DESCRIPTION"); value == "false" {
+		c.Description = ""
+	} else if value != "" {
+		c.Description = value
+	}
+
+	boolVars := map[string]*bool{
+		"DEV":              &c.Dev,
+		"PUBLISH_TO_NOSTR": &c.Nostr.Publish,
+		"BLOGO_METRICS":    &c.Metrics,
+	}
+	for name, field := range boolVars {
+		if value := os.Getenv(name); value != "" {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%v must be true or false, got %q", name, value))
+				continue
+			}
+			*field = b
+		}
+	}
+
+	intVars := map[string]*int{
+		"BLOGO_PORT":      &c.Port,
+		"BLOGO_PAGE_SIZE": &c.PageSize,
+	}
+	for name, field := range intVars {
+		if value := os.Getenv(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%v must be a number, got %q", name, value))
+				continue
+			}
+			*field = n
+		}
+	}
+
+	// NOSTR_RELAY_LIST is the name used in older docs
+	relays := os.Getenv("NOSTR_RELAYS")
+	if relays == "" {
+		relays = os.Getenv("NOSTR_RELAY_LIST")
+	}
+	if relays != "" {
+		c.Nostr.Relays = strings.Split(relays, ",")
+	}
+	return errors.Join(errs...)
+}
+
+// Normalizes the config values and checks they are valid, returning all the
+// problems found.
+func (c *Config) Validate() error {
+	var errs []error
+
+	c.Url = strings.TrimSuffix(c.Url, "/")
+	if u, err := url.Parse(c.Url); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("url must be an absolute http(s) URL, got %q", c.Url))
+	}
+
+	if location, err := time.LoadLocation(c.Timezone); err != nil {
+		errs = append(errs, fmt.Errorf("invalid timezone %q: %v", c.Timezone, err))
+	} else {
+		c.Location = location
+	}
+
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port must be between 1 and 65535, got %v", c.Port))
+	}
+
+	timeouts := map[string]Duration{
+		"read_timeout":     c.Server.ReadTimeout,
+		"write_timeout":    c.Server.WriteTimeout,
+		"idle_timeout":     c.Server.IdleTimeout,
+		"shutdown_timeout": c.Server.ShutdownTimeout,
+	}
+	for name, timeout := range timeouts {
+		if timeout < 0 {
+			errs = append(errs, fmt.Errorf("server %v can not be negative, got %v", name, timeout))
+		}
+	}
+
+	if c.PageSize < 1 {
+		errs = append(errs, fmt.Errorf("page_size must be at least 1, got %v", c.PageSize))
+	}
+
+	for _, origin := range c.Security.CorsOrigins {
+		if u, err := url.Parse(origin); origin != "*" && (err != nil || u.Scheme == "" || u.Host == "" || u.Path != "") {
+			errs = append(errs, fmt.Errorf("cors origin must be * or like https://example.com, got %q", origin))
+		}
+	}
+
+	if c.Log.Format != "console" && c.Log.Format != "json" {
+		errs = append(errs, fmt.Errorf("log format must be console or json, got %q", c.Log.Format))
+	}
+	if _, err := zerolog.ParseLevel(c.Log.Level); err != nil || c.Log.Level == "" {
+		errs = append(errs, fmt.Errorf("log level must be debug, info, warn or error, got %q", c.Log.Level))
+	}
+
+	if err := validatePermalink(c.Permalink, c.AllLanguages()); err != nil {
+		errs = append(errs, err)
+	}
+
+	c.ContentPath = strings.TrimSuffix(c.ContentPath, "/")
+	if c.ContentPath == "" {
+		c.ContentPath = "/"
+	}
+	if info, err := os.Stat(c.ContentPath); err != nil || !info.IsDir() {
+		errs = append(errs, fmt.Errorf("content path %q is not a directory", c.ContentPath))
+	}
+
+	if c.Theme != "" && c.Theme != "default" {
+		dir := path.Join(c.ContentPath, "themes", c.Theme)
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			errs = append(errs, fmt.Errorf("theme %q not found in %v", c.Theme, dir))
+		}
+	}
+
+	for _, lang := range c.AllLanguages() {
+		if !languageRegex.MatchString(lang) {
+			errs = append(errs, fmt.Errorf("invalid language code %q, use codes like en or pt-BR", lang))
+		}
+	}
+
+	for name, items := range c.Menus {
+		for i, item := range items {
+			if item.Title == "" || item.Url == "" {
+				errs = append(errs, fmt.Errorf("menu %v: item %v needs a title and a url", name, i+1))
+			}
+		}
+	}
+
+	aliases := map[string]string{}
+	for alias, tag := range c.TagAliases {
+		if slugify(alias) == "" || slugify(tag) == "" {
+			errs = append(errs, fmt.Errorf("tag alias %q: %q is not a valid tag", alias, tag))
+			continue
+		}
+		aliases[slugify(alias)] = tag
+	}
+	c.TagAliases = aliases
+
+	for i, relay := range c.Nostr.Relays {
+		relay = strings.TrimSpace(relay)
+		c.Nostr.Relays[i] = relay
+		if u, err := url.Parse(relay); err != nil || (u.Scheme != "ws" && u.Scheme != "wss") {
+			errs = append(errs, fmt.Errorf("nostr relay must be a ws:// or wss:// URL, got %q", relay))
+		}
+	}
+	if c.Nostr.Nsec != "" {
+		if prefix, _, err := nip19.Decode(c.Nostr.Nsec); err != nil || prefix != "nsec" {
+			errs = append(errs, fmt.Errorf("nostr nsec is not a valid nsec key"))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// A time.Duration written like 30s or 1m30s in the config file
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	value, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(value)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+var languageRegex = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// Returns the site language followed by the other languages of the site
+func (c Config) AllLanguages() []string {
+	languages := []string{c.Language}
+	for _, lang := range c.Languages {
+		if !StringInSlice(lang, languages) {
+			languages = append(languages, lang)
+		}
+	}
+	return languages
+}
+
+// Settings of the built-in layouts, unless set in the config
+var defaultLayouts = map[string]LayoutConfig{
+	"post":  {Listed: true},
+	"link":  {Listed: true},
+	"photo": {Listed: true},
+	"note":  {Listed: true},
+	"page":  {Standalone: true},
+}
+
+// Returns the settings of a layout. Articles without a layout are posts, and
+// unknown layouts are listed like posts.
+func (c Config) Layout(name string) LayoutConfig {
+	if name == "" {
+		name = "post"
+	}
+	if layout, ok := c.Layouts[name]; ok {
+		return layout
+	}
+	if layout, ok := defaultLayouts[name]; ok {
+		return layout
+	}
+	return LayoutConfig{Listed: true}
+}
+
+// Returns a copy of the config safe to print, with secrets redacted.
+func (c Config) Redacted() Config {
+	if c.Nostr.Nsec != "" {
+		c.Nostr.Nsec = "REDACTED"
+	}
+	return c
+}
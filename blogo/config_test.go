@@ -0,0 +1,166 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	if got := FindConfigFile("", dir); got != "" {
+		t.Errorf("FindConfigFile without a config file = %q", got)
+	}
+	if got := FindConfigFile("other.yaml", dir); got != "other.yaml" {
+		t.Errorf("FindConfigFile with a file = %q", got)
+	}
+	for _, name := range []string{"blogo.toml", "blogo.yaml"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	if got := FindConfigFile("", dir); got != filepath.Join(dir, "blogo.yaml") {
+		t.Errorf("FindConfigFile = %q, want blogo.yaml first", got)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"blogo.yaml": "title: From YAML\nport: 8080\nnostr:\n  relays: [wss://relay.example.com]\n",
+		"blogo.toml": "title = \"From TOML\"\nport = 8081\n",
+	}
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := LoadConfig(file)
+		if err != nil {
+			t.Fatalf("LoadConfig(%v): %v", name, err)
+		}
+		if !strings.HasPrefix(cfg.Title, "From ") || cfg.Port < 8080 || cfg.Description != DefaultConfig().Description {
+			t.Errorf("LoadConfig(%v) = %+v", name, cfg)
+		}
+	}
+
+	// The environment wins over the file
+	t.Setenv("BLOGO_TITLE", "From env")
+	t.Setenv("BLOGO_DESCRIPTION", "false")
+	t.Setenv("NOSTR_RELAY_LIST", "wss://a.example.com,wss://b.example.com")
+	cfg, err := LoadConfig(filepath.Join(dir, "blogo.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Title != "From env" || cfg.Description != "" || cfg.Port != 8080 || len(cfg.Nostr.Relays) != 2 {
+		t.Errorf("LoadConfig with env = %+v", cfg)
+	}
+
+	t.Setenv("BLOGO_PORT", "eighty")
+	if _, err := LoadConfig(""); err == nil || !strings.Contains(err.Error(), "BLOGO_PORT") {
+		t.Errorf("LoadConfig with an invalid port: %v", err)
+	}
+
+	unknown := filepath.Join(dir, "unknown.yaml")
+	os.WriteFile(unknown, []byte("titel: typo\n"), 0644)
+	if _, err := LoadConfig(unknown); err == nil {
+		t.Error("LoadConfig accepted an unknown key")
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ContentPath = t.TempDir() + "/"
+	cfg.Url = "https://example.com/"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate the default config: %v", err)
+	}
+	if cfg.Url != "https://example.com" || strings.HasSuffix(cfg.ContentPath, "/") {
+		t.Errorf("Validate did not normalize the url %q and content path %q", cfg.Url, cfg.ContentPath)
+	}
+
+	cfg.Url = "example.com"
+	cfg.Timezone = "Mars/Olympus"
+	cfg.Port = 0
+	cfg.Nostr.Relays = []string{"https://relay.example.com"}
+	cfg.Nostr.Nsec = "npub1nope"
+	err := cfg.Validate()
+	for _, want := range []string{"url", "timezone", "port", "relay", "nsec"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate did not report the %v: %v", want, err)
+		}
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Nostr.Nsec = "nsec1secret"
+	if cfg.Redacted().Nostr.Nsec == cfg.Nostr.Nsec || cfg.Nostr.Nsec != "nsec1secret" {
+		t.Error("Redacted did not hide the nsec, or changed the config")
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	dir := t.TempDir()
+	withConfig(t, func(c *Config) { c.ContentPath, c.Port = dir, 3000 })
+	configFile, envFile := ConfigFile, EnvFile
+	t.Cleanup(func() { ConfigFile, EnvFile = configFile, envFile })
+	ConfigFile, EnvFile = filepath.Join(dir, "blogo.yaml"), filepath.Join(dir, ".env")
+
+	write := func(content string) {
+		if err := os.WriteFile(ConfigFile, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("title: Reloaded\nport: 4000\ncontent_path: " + dir + "\n")
+	if err := ReloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	// The port needs a restart
+	if cfg := Site().Config; cfg.Title != "Reloaded" || cfg.Port != 3000 {
+		t.Errorf("reloaded title %q and port %v, want Reloaded and 3000", cfg.Title, cfg.Port)
+	}
+
+	write("title: Broken\nport: 0\ncontent_path: " + dir + "\n")
+	if err := ReloadConfig(); err == nil {
+		t.Error("reloaded an invalid config")
+	}
+	if Site().Config.Title != "Reloaded" {
+		t.Errorf("an invalid config replaced the running one")
+	}
+}
+
+func TestServerConfig(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"blogo.yaml": "server:\n  read_timeout: 5s\n  shutdown_timeout: 1m30s\n",
+		"blogo.toml": "[server]\nread_timeout = \"5s\"\nshutdown_timeout = \"1m30s\"\n",
+	}
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		os.WriteFile(file, []byte(content), 0644)
+		cfg, err := LoadConfig(file)
+		if err != nil {
+			t.Fatalf("LoadConfig(%v): %v", name, err)
+		}
+		if cfg.Server.ReadTimeout != Duration(5*time.Second) || cfg.Server.ShutdownTimeout != Duration(90*time.Second) {
+			t.Errorf("LoadConfig(%v) server = %+v", name, cfg.Server)
+		}
+		// Unset timeouts keep their default
+		if cfg.Server.IdleTimeout != DefaultConfig().Server.IdleTimeout {
+			t.Errorf("LoadConfig(%v) idle timeout = %v", name, cfg.Server.IdleTimeout)
+		}
+	}
+
+	invalid := filepath.Join(dir, "invalid.yaml")
+	os.WriteFile(invalid, []byte("server:\n  read_timeout: soon\n"), 0644)
+	if _, err := LoadConfig(invalid); err == nil {
+		t.Error("LoadConfig accepted an invalid duration")
+	}
+
+	cfg := DefaultConfig()
+	cfg.Server.WriteTimeout = Duration(-time.Second)
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "write_timeout") {
+		t.Errorf("Validate with a negative timeout: %v", err)
+	}
+}
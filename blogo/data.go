@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Loads the YAML and JSON files of the data folder into the site data. A
+// file that can not be parsed keeps its previous data until it is fixed.
+func LoadData() error {
+	root := path.Join(Site().Config.ContentPath, "data")
+	previous := Site().Data
+	data := map[string]interface{}{}
+	err := filepath.Walk(root, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if fpath == root && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		name, ext := ParseFilePath(fpath)
+		if ext != ".yaml" && ext != ".yml" && ext != ".json" {
+			return nil
+		}
+		value, err := readDataFile(fpath)
+		if err != nil {
+			Log("content").Error().Err(err).Msgf("Could not load data file %v", fpath)
+			SetLoadError(fpath, err)
+			value = previous[name]
+		} else {
+			ClearLoadError(fpath)
+		}
+		if value != nil {
+			data[name] = value
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	UpdateSite(func(s *siteState) { s.Data = data })
+	BumpGeneration()
+	Log("content").Info().Msgf("Loaded %v data files", len(data))
+	return nil
+}
+
+func readDataFile(fpath string) (interface{}, error) {
+	content, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	if strings.HasSuffix(fpath, ".json") {
+		err = json.Unmarshal(content, &value)
+	} else {
+		err = yaml.Unmarshal(content, &value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %v: %v", fpath, err)
+	}
+	return value, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadData(t *testing.T) {
+	dir := withContent(t, map[string]string{
+		"data/social.yaml":   "- name: Mastodon\n  url: https://mastodon.social/@me\n",
+		"data/projects.json": `{"blogo": "A blog engine"}`,
+		"data/notes.txt":     "not data",
+	})
+	t.Cleanup(func() { ClearLoadError(filepath.Join(dir, "data", "social.yaml")) })
+	if err := LoadData(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"social":   []interface{}{map[string]interface{}{"name": "Mastodon", "url": "https://mastodon.social/@me"}},
+		"projects": map[string]interface{}{"blogo": "A blog engine"},
+	}
+	if got := Site().Data; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Data = %v, want %v", got, want)
+	}
+
+	// A broken file keeps its previous data
+	os.WriteFile(filepath.Join(dir, "data", "social.yaml"), []byte("- [broken"), 0644)
+	if err := LoadData(); err != nil {
+		t.Fatal(err)
+	}
+	if got := Site().Data; !reflect.DeepEqual(got, want) {
+		t.Errorf("Data = %v after breaking social.yaml, want %v", got, want)
+	}
+	if errs := GetLoadErrors(); len(errs) != 1 {
+		t.Errorf("load errors %+v, want one for social.yaml", errs)
+	}
+}
+
+func TestMenu(t *testing.T) {
+	withBadger(t)
+	withConfig(t, func(c *Config) {
+		c.Menus = map[string][]MenuItem{
+			"footer": {
+				{Title: "Source", Url: "https://example.com/src", Weight: 2},
+				{Title: "Feed", Url: "/rss"},
+			},
+		}
+	})
+
+	want := []MenuItem{{Title: "Feed", Url: "/rss"}, {Title: "Source", Url: "https://example.com/src", Weight: 2}}
+	if got := Menu("footer"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Menu(footer) = %v, want %v", got, want)
+	}
+	if got := Menu("missing"); len(got) != 0 {
+		t.Errorf("Menu(missing) = %v, want no items", got)
+	}
+}
+
+func TestValidateMenus(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Menus = map[string][]MenuItem{"main": {{Title: "No url"}}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("a menu item without url is valid")
+	}
+}
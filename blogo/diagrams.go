@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+var KindDiagram = ast.NewNodeKind("Diagram")
+
+// Diagram is a fenced code block (```mermaid or ```dot) that will be rendered
+// to an inline SVG when the article is generated.
+type Diagram struct {
+	ast.BaseBlock
+	Language string
+}
+
+func (n *Diagram) Kind() ast.NodeKind { return KindDiagram }
+
+func (n *Diagram) IsRaw() bool { return true }
+
+func (n *Diagram) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Language": n.Language}, nil)
+}
+
+// Diagrams is a goldmark extension rendering Mermaid and Graphviz code fences
+// to SVG using the configured external commands.
+type Diagrams struct {
+	MermaidCmd  string
+	GraphvizCmd string
+}
+
+func (e *Diagrams) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithASTTransformers(util.Prioritized(&diagramTransformer{}, 100)),
+	)
+	m.Renderer().AddOptions(
+		renderer.WithNodeRenderers(util.Prioritized(&diagramRenderer{config: e}, 100)),
+	)
+}
+
+type diagramTransformer struct{}
+
+func (t *diagramTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	var blocks []*ast.FencedCodeBlock
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if fcb, ok := n.(*ast.FencedCodeBlock); ok && entering {
+			blocks = append(blocks, fcb)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, fcb := range blocks {
+		lang := string(fcb.Language(reader.Source()))
+		if lang == "graphviz" {
+			lang = "dot"
+		}
+		if lang != "mermaid" && lang != "dot" {
+			continue
+		}
+		diagram := &Diagram{Language: lang}
+		diagram.SetLines(fcb.Lines())
+		fcb.Parent().ReplaceChild(fcb.Parent(), fcb, diagram)
+	}
+}
+
+type diagramRenderer struct {
+	config *Diagrams
+}
+
+// Rendered diagrams keyed by the hash of their source, so that reloading an
+// article does not spawn the external renderers again.
+var diagramCache sync.Map
+
+func (r *diagramRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindDiagram, r.render)
+}
+
+func (r *diagramRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkSkipChildren, nil
+	}
+	n := node.(*Diagram)
+	var buf bytes.Buffer
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		buf.Write(segment.Value(source))
+	}
+
+	svg, err := r.renderSvg(n.Language, buf.Bytes())
+	if err != nil {
+		Log("render").Warn().Err(err).Msgf("Could not render %v diagram, falling back to code block", n.Language)
+		w.WriteString(fmt.Sprintf("<pre><code class=\"language-%v\">", n.Language))
+		w.WriteString(html.EscapeString(buf.String()))
+		w.WriteString("</code></pre>\n")
+		return ast.WalkSkipChildren, nil
+	}
+
+	w.WriteString(fmt.Sprintf("<figure class=\"diagram diagram-%v\">", n.Language))
+	w.Write(svg)
+	w.WriteString("</figure>\n")
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *diagramRenderer) renderSvg(lang string, src []byte) ([]byte, error) {
+	key := fmt.Sprintf("%v-%x", lang, sha256.Sum256(src))
+	if svg, ok := diagramCache.Load(key); ok {
+		return svg.([]byte), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var svg []byte
+	var err error
+	switch lang {
+	case "dot":
+		svg, err = runDiagramCmd(ctx, r.config.GraphvizCmd, src, "-Tsvg")
+	case "mermaid":
+		svg, err = runMermaid(ctx, r.config.MermaidCmd, src)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Drop the XML prolog and doctype, they are not valid inside HTML.
+	if i := bytes.Index(svg, []byte("<svg")); i > 0 {
+		svg = svg[i:]
+	}
+	svg = moveStyleAttributes(svg)
+	diagramCache.Store(key, svg)
+	return svg, nil
+}
+
+var styleAttrRegex = regexp.MustCompile(`\sstyle="([^"]*)"`)
+
+// Moves the style attributes of an SVG into a <style> element. The Content
+// Security Policy allows the <style> elements of the articles by their hash,
+// but no style attributes. The declarations are !important so they still win
+// over the other rules of the diagram, as they did inline.
+func moveStyleAttributes(svg []byte) []byte {
+	var rules strings.Builder
+	written := map[string]bool{}
+	svg = styleAttrRegex.ReplaceAllFunc(svg, func(attr []byte) []byte {
+		style := html.UnescapeString(string(styleAttrRegex.FindSubmatch(attr)[1]))
+		// It could close the <style> element
+		if strings.Contains(style, "<") {
+			return nil
+		}
+		id := fmt.Sprintf("%x", sha256.Sum256([]byte(style)))[:10]
+		if !written[id] {
+			written[id] = true
+			rules.WriteString(`[data-style="` + id + `"]{`)
+			for _, declaration := range strings.Split(style, ";") {
+				if declaration = strings.TrimSpace(declaration); declaration != "" {
+					if !strings.HasSuffix(declaration, "!important") {
+						declaration += " !important"
+					}
+					rules.WriteString(declaration + ";")
+				}
+			}
+			rules.WriteString("}")
+		}
+		return []byte(` data-style="` + id + `"`)
+	})
+	if rules.Len() == 0 {
+		return svg
+	}
+
+	// Right after the opening <svg> tag
+	end := bytes.IndexByte(svg, '>')
+	if end < 0 {
+		return svg
+	}
+	var out bytes.Buffer
+	out.Write(svg[:end+1])
+	out.WriteString("<style>" + rules.String() + "</style>")
+	out.Write(svg[end+1:])
+	return out.Bytes()
+}
+
+func runDiagramCmd(ctx context.Context, command string, stdin []byte, args ...string) ([]byte, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no command configured")
+	}
+	cmd := exec.CommandContext(ctx, fields[0], append(fields[1:], args...)...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v %v", fields[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// The mermaid CLI only works with files, so we go through a temporary directory.
+func runMermaid(ctx context.Context, command string, src []byte) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "blogo-mermaid-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "diagram.mmd")
+	out := filepath.Join(dir, "diagram.svg")
+	if err := os.WriteFile(in, src, 0644); err != nil {
+		return nil, err
+	}
+	if _, err := runDiagramCmd(ctx, command, nil, "-i", in, "-o", out); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(out)
+}
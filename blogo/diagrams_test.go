@@ -0,0 +1,39 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestMoveStyleAttributes(t *testing.T) {
+	svg := `<svg viewBox="0 0 10 10"><rect style="fill:#fff;stroke:red"/><text style="fill:#fff;stroke:red">a</text><path style="stroke:blue !important;"/></svg>`
+	got := string(moveStyleAttributes([]byte(svg)))
+
+	if strings.Contains(got, " style=") {
+		t.Errorf("style attributes left in %v", got)
+	}
+	ids := regexp.MustCompile(` data-style="([0-9a-f]+)"`).FindAllStringSubmatch(got, -1)
+	if len(ids) != 3 || ids[0][1] != ids[1][1] || ids[0][1] == ids[2][1] {
+		t.Fatalf("data-style attributes %v", ids)
+	}
+	wantStyle := `<svg viewBox="0 0 10 10"><style>` +
+		`[data-style="` + ids[0][1] + `"]{fill:#fff !important;stroke:red !important;}` +
+		`[data-style="` + ids[2][1] + `"]{stroke:blue !important;}` +
+		`</style>`
+	if !strings.HasPrefix(got, wantStyle) {
+		t.Errorf("moveStyleAttributes = %v, want it to start with %v", got, wantStyle)
+	}
+
+	// Nothing to move
+	plain := `<svg><rect fill="#fff"/></svg>`
+	if got := string(moveStyleAttributes([]byte(plain))); got != plain {
+		t.Errorf("moveStyleAttributes(%v) = %v", plain, got)
+	}
+
+	// A style that could close the <style> element is dropped
+	got = string(moveStyleAttributes([]byte(`<svg><rect style="x:&lt;/style&gt;"/></svg>`)))
+	if got != `<svg><rect/></svg>` {
+		t.Errorf("unsafe style kept: %v", got)
+	}
+}
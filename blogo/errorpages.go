@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Renders the 404 page of the theme, suggesting the posts and pages with a
+// slug close to the requested one
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	if redirectMoved(w, r) {
+		return
+	}
+	site := Site()
+	slug := path.Base(strings.TrimSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/raw"))
+	varmap := map[string]interface{}{
+		"Blogo":       site.Config,
+		"Data":        site.Data,
+		"Lang":        errorLang(r),
+		"Path":        r.URL.Path,
+		"Suggestions": SimilarArticles(slug, 3),
+	}
+	renderError(w, http.StatusNotFound, site.Templates.NotFound, varmap)
+}
+
+// Logs an error and renders the 500 page of the theme. The error is only
+// shown in dev mode.
+func ServerError(w http.ResponseWriter, r *http.Request, err error) {
+	zerolog.Ctx(r.Context()).Error().Err(err).Str("path", r.URL.Path).Msg("Error serving the request")
+	site := Site()
+	varmap := map[string]interface{}{
+		"Blogo": site.Config,
+		"Data":  site.Data,
+		"Lang":  errorLang(r),
+		"Path":  r.URL.Path,
+	}
+	if site.Config.Dev {
+		varmap["Error"] = err.Error()
+	}
+	renderError(w, http.StatusInternalServerError, site.Templates.Error, varmap)
+}
+
+func renderError(w http.ResponseWriter, status int, tmpl *template.Template, varmap map[string]interface{}) {
+	var page bytes.Buffer
+	if tmpl == nil {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	if err := tmpl.ExecuteTemplate(&page, "base", varmap); err != nil {
+		log.Error().Err(err).Msgf("Error rendering the %v page", status)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(page.Bytes())
+}
+
+// Renders a template into the response, or the 500 page if it fails, so a
+// broken template never sends half a page with a 200
+func render(w http.ResponseWriter, r *http.Request, tmpl *template.Template, varmap map[string]interface{}) {
+	var page bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&page, "base", varmap); err != nil {
+		ServerError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page.Bytes())
+}
+
+// The language of the URL of a request, like es for /es/nope
+func errorLang(r *http.Request) string {
+	lang := chi.URLParam(r, "lang")
+	if lang == "" {
+		lang, _, _ = strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	}
+	cfg := Site().Config
+	if StringInSlice(lang, cfg.AllLanguages()) {
+		return lang
+	}
+	return cfg.Language
+}
+
+// Returns links to up to limit published posts and pages whose slug looks
+// like the given one, the closest first
+func SimilarArticles(slug string, limit int) []MenuItem {
+	slug = strings.ToLower(slug)
+	if slug == "" || slug == "." || slug == "/" {
+		return nil
+	}
+
+	type match struct {
+		link     MenuItem
+		distance int
+	}
+	var matches []match
+	add := func(article ArticleData, url string) {
+		if article.Draft {
+			return
+		}
+		distance := levenshtein(slug, article.Slug)
+		if strings.Contains(article.Slug, slug) || strings.Contains(slug, article.Slug) {
+			distance = min(distance, 1)
+		}
+		// Allow about one typo every three letters
+		if distance <= max(2, len([]rune(slug))/3) {
+			matches = append(matches, match{MenuItem{Title: article.Title, Url: url}, distance})
+		}
+	}
+	for _, article := range Badger.GetArticleIndex() {
+		add(article, ArticlePath(article))
+	}
+	for _, page := range Badger.GetAllPages() {
+		add(page, "/"+page.Slug)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].distance < matches[j].distance
+	})
+
+	var links []MenuItem
+	for i := 0; i < len(matches) && i < limit; i++ {
+		links = append(links, matches[i].link)
+	}
+	return links
+}
+
+// Returns the number of single letter edits between two strings
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"abc", "abc", 0},
+		{"kitten", "sitting", 3},
+		{"hello-world", "helo-world", 1},
+		{"café", "cafe", 1},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		if got := levenshtein(tt.b, tt.a); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %v, want %v", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestSimilarArticles(t *testing.T) {
+	withBadger(t)
+	articles := []ArticleData{
+		{Slug: "hello-world", Title: "Hello world"},
+		{Slug: "hello-draft", Title: "Draft", Draft: true},
+		{Slug: "something-else", Title: "Something else"},
+	}
+	for _, article := range articles {
+		if err := Badger.SetArticle(article); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { Badger.DeleteArticle(article.Slug) })
+	}
+
+	links := SimilarArticles("helo-world", 3)
+	if len(links) != 1 || links[0].Title != "Hello world" {
+		t.Errorf("SimilarArticles(helo-world) = %+v, want only Hello world", links)
+	}
+	if links := SimilarArticles("/", 3); links != nil {
+		t.Errorf("SimilarArticles(/) = %+v, want none", links)
+	}
+}
+
+func TestNotFoundWithoutTemplate(t *testing.T) {
+	withBadger(t)
+	previous := Site()
+	UpdateSite(func(s *siteState) { s.Templates.NotFound = nil })
+	t.Cleanup(func() { site.Store(previous) })
+
+	w := httptest.NewRecorder()
+	NotFound(w, httptest.NewRequest("GET", "/nope", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("NotFound without a theme template = %v, want 404", w.Code)
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Accepted formats for the Date field, in order of preference
+var dateFormats = []string{"2006-01-02 15:04", "2006-01-02", time.RFC3339}
+
+// FrontMatter is the typed YAML metadata block at the top of an article.
+type FrontMatter struct {
+	Title   string
+	Author  string
+	Summary string
+	Tags    []string
+	Aliases []string
+	Image   string
+	Date    time.Time
+	Draft   bool
+	Layout  string
+	Link    string
+	Menu    string
+	Weight  int
+	Lang    string
+	// Links the translations of an article
+	TranslationKey string
+	NostrUrl       string
+}
+
+// A problem found while validating a front matter block
+type FrontMatterError struct {
+	File   string
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e FrontMatterError) Error() string {
+	return fmt.Sprintf("%v:%v:%v: %v", e.File, e.Line, e.Column, e.Msg)
+}
+
+type FrontMatterErrors []FrontMatterError
+
+func (e FrontMatterErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Known front matter keys and whether they are required
+var frontMatterKeys = map[string]bool{
+	"Title":          true,
+	"Date":           true,
+	"Draft":          true,
+	"Author":         false,
+	"Summary":        false,
+	"Tags":           false,
+	"Aliases":        false,
+	"Image":          false,
+	"Layout":         false,
+	"Link":           false,
+	"Menu":           false,
+	"Weight":         false,
+	"Lang":           false,
+	"TranslationKey": false,
+	"NostrUrl":       false,
+}
+
+// Extracts the YAML block between the leading `---` lines of a markdown file.
+func splitFrontMatter(content []byte) ([]byte, bool) {
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	if !bytes.HasPrefix(content, []byte("---")) {
+		return nil, false
+	}
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	var block bytes.Buffer
+	for _, line := range lines[1:] {
+		if bytes.Equal(bytes.TrimRight(line, " \t\r\n"), []byte("---")) {
+			return block.Bytes(), true
+		}
+		block.Write(line)
+	}
+	return nil, false
+}
+
+// Parses and validates the front matter of a markdown file, returning every
+// problem found instead of stopping at the first one. Files with relaxed set
+// to true (pages) have no required fields.
+func ParseFrontMatter(filepath string, content []byte, relaxed bool) (FrontMatter, FrontMatterErrors) {
+	var fm FrontMatter
+	var errs FrontMatterErrors
+	report := func(node *yaml.Node, format string, args ...interface{}) {
+		e := FrontMatterError{File: filepath, Line: 1, Column: 1, Msg: fmt.Sprintf(format, args...)}
+		if node != nil {
+			// The block starts after the opening `---` line
+			e.Line, e.Column = node.Line+1, node.Column
+		}
+		errs = append(errs, e)
+	}
+
+	block, ok := splitFrontMatter(content)
+	if !ok {
+		if !relaxed {
+			report(nil, "missing front matter block delimited by ---")
+		}
+		return fm, errs
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(block, &doc); err != nil {
+		report(nil, "invalid YAML: %v", err)
+		return fm, errs
+	}
+	mapping := &yaml.Node{Kind: yaml.MappingNode}
+	if len(doc.Content) > 0 {
+		mapping = doc.Content[0]
+	}
+	if mapping.Kind != yaml.MappingNode {
+		report(mapping, "front matter must be a mapping of keys to values")
+		return fm, errs
+	}
+
+	seen := map[string]bool{}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		if _, known := frontMatterKeys[key.Value]; !known {
+			report(key, "unknown key %q%v", key.Value, suggestKey(key.Value))
+			continue
+		}
+		if seen[key.Value] {
+			report(key, "duplicated key %q", key.Value)
+		}
+		seen[key.Value] = true
+
+		switch key.Value {
+		case "Tags":
+			if value.Kind == yaml.ScalarNode && value.Tag == "!!null" {
+				continue
+			}
+			if value.Kind != yaml.SequenceNode {
+				report(value, "Tags must be a list of strings")
+				continue
+			}
+			for _, tag := range value.Content {
+				if tag.Kind != yaml.ScalarNode {
+					report(tag, "tags must be strings")
+				} else if tag.Tag != "!!str" {
+					report(tag, "tag %q must be a string, quote it", tag.Value)
+				} else if strings.TrimSpace(tag.Value) == "" {
+					report(tag, "tags can not be empty")
+				} else {
+					fm.Tags = append(fm.Tags, tag.Value)
+				}
+			}
+		case "Aliases":
+			if value.Kind == yaml.ScalarNode && value.Tag == "!!null" {
+				continue
+			}
+			if value.Kind != yaml.SequenceNode {
+				report(value, "Aliases must be a list of old slugs or paths")
+				continue
+			}
+			for _, alias := range value.Content {
+				if alias.Kind != yaml.ScalarNode || strings.TrimSpace(alias.Value) == "" {
+					report(alias, "aliases must be non empty strings")
+				} else {
+					fm.Aliases = append(fm.Aliases, alias.Value)
+				}
+			}
+		case "Draft":
+			draft, err := strconv.ParseBool(value.Value)
+			if value.Kind != yaml.ScalarNode || err != nil {
+				report(value, "Draft must be true or false, got %q", value.Value)
+			}
+			fm.Draft = draft
+		case "Date":
+			if value.Kind != yaml.ScalarNode {
+				report(value, "Date must be a string")
+				continue
+			}
+			date, err := parseDate(value.Value)
+			if err != nil {
+				report(value, "invalid Date %q, expected one of the formats: %v", value.Value, strings.Join(dateFormats, ", "))
+			}
+			fm.Date = date
+		default:
+			if value.Kind != yaml.ScalarNode {
+				report(value, "%v must be a single value", key.Value)
+				continue
+			}
+			switch key.Value {
+			case "Title":
+				fm.Title = value.Value
+			case "Author":
+				fm.Author = value.Value
+			case "Summary":
+				fm.Summary = value.Value
+			case "Layout":
+				fm.Layout = value.Value
+			case "Menu":
+				fm.Menu = value.Value
+			case "Weight":
+				weight, err := strconv.Atoi(value.Value)
+				if err != nil {
+					report(value, "Weight must be a number, got %q", value.Value)
+				}
+				fm.Weight = weight
+			case "Lang":
+				fm.Lang = value.Value
+				if !StringInSlice(value.Value, Site().Config.AllLanguages()) {
+					report(value, "unknown Lang %q, add it to the languages in the config file (%v)", value.Value, strings.Join(Site().Config.AllLanguages(), ", "))
+				}
+			case "TranslationKey":
+				fm.TranslationKey = value.Value
+			case "Link":
+				fm.Link = value.Value
+				if u, err := url.Parse(value.Value); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+					report(value, "Link must be an http(s) URL, got %q", value.Value)
+				}
+			case "NostrUrl":
+				fm.NostrUrl = value.Value
+			case "Image":
+				fm.Image = value.Value
+				if msg := checkImage(value.Value); msg != "" {
+					report(value, "%v", msg)
+				}
+			}
+		}
+	}
+
+	if !relaxed {
+		var missing []string
+		for key, required := range frontMatterKeys {
+			if required && !seen[key] {
+				missing = append(missing, key)
+			}
+		}
+		sort.Strings(missing)
+		for _, key := range missing {
+			report(mapping, "missing required key %q", key)
+		}
+		if seen["Title"] && strings.TrimSpace(fm.Title) == "" {
+			report(mapping, "Title can not be empty")
+		}
+	}
+
+	return fm, errs
+}
+
+// Parses a Date of the front matter. Dates without a timezone are in the
+// timezone of the site, and all of them are returned in it, so the year and
+// month of a post are the ones of the site everywhere.
+func parseDate(value string) (time.Time, error) {
+	location := Site().Config.Location
+	var err error
+	for _, format := range dateFormats {
+		var date time.Time
+		if date, err = time.ParseInLocation(format, value, location); err == nil {
+			return date.In(location), nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// Checks that an image is either a remote URL or an existing local file.
+func checkImage(image string) string {
+	if image == "" {
+		return ""
+	}
+	if u, err := url.Parse(image); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		return ""
+	}
+	if !strings.HasPrefix(image, "/") {
+		return fmt.Sprintf("Image %q must be an http(s) URL or a path starting with /", image)
+	}
+	local := path.Join(Site().Config.ContentPath, filepath.Clean(image))
+	if _, err := os.Stat(local); err != nil {
+		return fmt.Sprintf("Image %q not found at %v", image, local)
+	}
+	return ""
+}
+
+func suggestKey(key string) string {
+	for known := range frontMatterKeys {
+		if strings.EqualFold(known, key) {
+			return fmt.Sprintf(", did you mean %q?", known)
+		}
+	}
+	return ""
+}
+
+// Validates the front matter of every article and page in the content
+// folder, returning all the problems found.
+func CheckArticles() (int, FrontMatterErrors) {
+	var problems FrontMatterErrors
+	checked := 0
+	for _, dir := range []string{"articles", "pages"} {
+		relaxed := dir == "pages"
+		root := path.Join(Site().Config.ContentPath, dir)
+		if _, err := os.Stat(root); os.IsNotExist(err) && relaxed {
+			continue
+		}
+		checked += checkDir(root, relaxed, &problems)
+	}
+	return checked, problems
+}
+
+func checkDir(root string, relaxed bool, problems *FrontMatterErrors) int {
+	checked := 0
+	err := filepath.Walk(root, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil {
+			*problems = append(*problems, FrontMatterError{File: fpath, Line: 1, Column: 1, Msg: err.Error()})
+			return nil
+		}
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".md") {
+			return nil
+		}
+		checked++
+		content, err := os.ReadFile(fpath)
+		if err != nil {
+			*problems = append(*problems, FrontMatterError{File: fpath, Line: 1, Column: 1, Msg: err.Error()})
+			return nil
+		}
+		_, errs := ParseFrontMatter(fpath, content, relaxed || isLegacyAbout(fpath))
+		*problems = append(*problems, errs...)
+		return nil
+	})
+	if err != nil {
+		*problems = append(*problems, FrontMatterError{File: root, Line: 1, Column: 1, Msg: err.Error()})
+	}
+	return checked
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	withTimezone(t, "UTC")
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"2024-03-07 10:30", time.Date(2024, 3, 7, 10, 30, 0, 0, time.UTC)},
+		{"2024-03-07", time.Date(2024, 3, 7, 0, 0, 0, 0, time.UTC)},
+		{"2024-03-07T10:30:00+02:00", time.Date(2024, 3, 7, 8, 30, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := parseDate(tt.value)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseDate(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+		}
+	}
+	for _, value := range []string{"", "07/03/2024", "2024-13-01", "yesterday"} {
+		if _, err := parseDate(value); err == nil {
+			t.Errorf("parseDate(%q) did not fail", value)
+		}
+	}
+}
+
+func TestParseFrontMatter(t *testing.T) {
+	withConfig(t, func(c *Config) {
+		c.Language, c.Languages = "en", nil
+	})
+	tests := []struct {
+		name    string
+		content string
+		relaxed bool
+		// One substring for every expected error, in order
+		errors []string
+	}{
+		{"valid", "---\nTitle: Hello\nDate: 2024-03-07\nDraft: false\nTags: [go, web]\n---\nBody", false, nil},
+		{"no block", "Body", false, []string{"missing front matter block"}},
+		{"no block in a page", "Body", true, nil},
+		{"unclosed block", "---\nTitle: Hello\n", false, []string{"missing front matter block"}},
+		{"invalid yaml", "---\nTitle: [\n---\n", false, []string{"invalid YAML"}},
+		{"not a mapping", "---\n- a\n---\n", false, []string{"must be a mapping"}},
+		{"missing keys", "---\nTitle: Hello\n---\n", false, []string{`missing required key "Date"`, `missing required key "Draft"`}},
+		{"missing keys in a page", "---\nTitle: Hello\n---\n", true, nil},
+		{"unknown key", "---\ntitle: Hello\nDate: 2024-03-07\nDraft: false\n---\n", false, []string{`unknown key "title", did you mean "Title"?`, `missing required key "Title"`}},
+		{"duplicated key", "---\nTitle: a\nTitle: b\nDate: 2024-03-07\nDraft: false\n---\n", false, []string{`duplicated key "Title"`}},
+		{"bad values", "---\nTitle: \"\"\nDate: 07/03/2024\nDraft: maybe\nTags: go\nWeight: heavy\n---\n", false, []string{
+			"invalid Date", "Draft must be true or false", "Tags must be a list", "Weight must be a number", "Title can not be empty",
+		}},
+		{"unquoted tag", "---\nTitle: a\nDate: 2024-03-07\nDraft: false\nTags: [1984]\n---\n", false, []string{`tag "1984" must be a string`}},
+		{"unknown language", "---\nTitle: a\nDate: 2024-03-07\nDraft: false\nLang: xx\n---\n", false, []string{`unknown Lang "xx"`}},
+		{"bad link", "---\nTitle: a\nDate: 2024-03-07\nDraft: false\nLink: ftp://example.com\n---\n", false, []string{"Link must be an http(s) URL"}},
+	}
+	for _, tt := range tests {
+		_, errs := ParseFrontMatter("post.md", []byte(tt.content), tt.relaxed)
+		if len(errs) != len(tt.errors) {
+			t.Errorf("%v: got errors %v, want %v", tt.name, errs, tt.errors)
+			continue
+		}
+		for i, want := range tt.errors {
+			if !strings.Contains(errs[i].Msg, want) {
+				t.Errorf("%v: error %v is %q, want %q", tt.name, i, errs[i].Msg, want)
+			}
+		}
+	}
+}
+
+func TestParseFrontMatterPositions(t *testing.T) {
+	_, errs := ParseFrontMatter("post.md", []byte("---\nTitle: a\nDate: 2024-03-07\nDraft: nope\n---\n"), false)
+	if len(errs) != 1 || errs[0].Line != 4 || errs[0].Column != 8 {
+		t.Fatalf("errors %v, want one at 4:8", errs)
+	}
+	if got := errs[0].Error(); got != `post.md:4:8: Draft must be true or false, got "nope"` {
+		t.Errorf("Error() = %v", got)
+	}
+}
+
+func TestCheckArticles(t *testing.T) {
+	withContent(t, map[string]string{
+		"articles/good.md":   "---\nTitle: Good\nDate: 2024-03-07\nDraft: false\n---\nBody",
+		"articles/bad.md":    "---\nTitle: Bad\nDraft: false\n---\nBody",
+		"articles/notes.txt": "not an article",
+		// Pages and the legacy about page have no required keys
+		"articles/about.md": "Body",
+		"pages/contact.md":  "---\nTitle: Contact\n---\nBody",
+	})
+
+	checked, problems := CheckArticles()
+	if checked != 4 || len(problems) != 1 || !strings.HasSuffix(problems[0].File, "bad.md") {
+		t.Errorf("checked %v articles with problems %v, want 4 with one in bad.md", checked, problems)
+	}
+}
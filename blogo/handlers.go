@@ -1,65 +1,142 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
 	"net/http"
-	"os"
+	"net/url"
 	"path"
-	"sort"
 	"strconv"
+	"time"
 
+	badger "github.com/dgraph-io/badger/v4"
 	"github.com/go-chi/chi/v5"
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
 )
 
-func GetIndex(w http.ResponseWriter, r *http.Request) {
-	page := r.URL.Query().Get("p")
+// Returns the language of a request from the URL prefix, like /es/. The
+// site language has no prefix.
+func requestLang(w http.ResponseWriter, r *http.Request) (string, bool) {
+	cfg := Site().Config
+	lang := chi.URLParam(r, "lang")
+	if lang == "" {
+		return cfg.Language, true
+	}
+	if lang == cfg.Language || !StringInSlice(lang, cfg.AllLanguages()) {
+		NotFound(w, r)
+		return "", false
+	}
+	return lang, true
+}
 
-	pageNum, _ := strconv.Atoi(page)
-	if pageNum <= 0 {
-		pageNum = 1
+// Returns the page number of a listing from its /page/<n> URL. The old
+// ?p=<n> URLs and /page/1 redirect to the URL of the page.
+func requestPage(w http.ResponseWriter, r *http.Request, path string) (int, bool) {
+	if p := r.URL.Query().Get("p"); p != "" {
+		page, _ := strconv.Atoi(p)
+		http.Redirect(w, r, Paginator{Path: path}.URL(page), http.StatusMovedPermanently)
+		return 0, false
 	}
 
-	from := (pageNum - 1) * 10
-	to := from + 10
+	param := chi.URLParam(r, "page")
+	if param == "" {
+		return 1, true
+	}
+	page, err := strconv.Atoi(param)
+	if err != nil || page < 1 {
+		NotFound(w, r)
+		return 0, false
+	}
+	if page == 1 {
+		http.Redirect(w, r, path, http.StatusMovedPermanently)
+		return 0, false
+	}
+	return page, true
+}
 
-	articles := Badger.GetAllArticles()
-	// Sort by date
-	sort.Slice(articles, func(i, j int) bool {
-		return articles[i].Date.After(articles[j].Date)
-	})
+func GetIndex(w http.ResponseWriter, r *http.Request) {
+	site := Site()
+	lang, ok := requestLang(w, r)
+	if !ok {
+		return
+	}
+	path := LangPath(lang) + "/"
+	page, ok := requestPage(w, r, path)
+	if !ok {
+		return
+	}
 
-	totalPages := int(math.Ceil(float64(len(articles)) / 10.0))
-	if to > len(articles) {
-		to = len(articles)
+	articles := ListedArticles(lang)
+	paginator, ok := NewPaginator(len(articles), page, path)
+	if !ok {
+		NotFound(w, r)
+		return
 	}
-	pagedArticles := articles[from:to]
 
 	varmap := map[string]interface{}{
-		"Articles":   pagedArticles,
-		"Blogo":      Blogo,
-		"Page":       pageNum,
-		"TotalPages": totalPages,
+		"Articles":   paginator.Articles(articles),
+		"Blogo":      site.Config,
+		"Data":       site.Data,
+		"Lang":       lang,
+		"Page":       paginator.Page,
+		"TotalPages": paginator.TotalPages,
+		"Paginator":  paginator,
 	}
 
-	log.Debug().Msgf("From: %d - To: %d", from, to)
 	// Execute the template from templates.go
-	if err := IndexTmpl.ExecuteTemplate(w, "base", varmap); err != nil {
-		log.Error().Err(err).Msg("Error executing template:")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	}
+	render(w, r, site.Templates.Index, varmap)
 }
 
 func ServeBlogPost(w http.ResponseWriter, r *http.Request) {
 	slug := chi.URLParam(r, "slug")
-	log.Debug().Msgf("%v", slug)
-	blogPath := fmt.Sprintf("%v/content", os.Getenv("CONTENT_PATH"))
+
+	article, ok := Badger.GetIndexedArticle(slug)
+	if !ok {
+		NotFound(w, r)
+		return
+	}
+	// The legacy /p/<slug> URLs, other dates and standalone pages redirect to
+	// the permalink
+	if target := ArticlePath(article); r.URL.Path != target {
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+		return
+	}
+
+	blogPath := fmt.Sprintf("%v/content", Site().Config.ContentPath)
 	filePath := path.Join(blogPath, fmt.Sprintf("%s.html", slug))
+	zerolog.Ctx(r.Context()).Debug().Str("slug", slug).Msgf("Serving %v", filePath)
 
-	log.Debug().Msgf("%v", filePath)
+	allowStyles(w, article.StyleHashes)
+	serveGenerated(w, r, filePath)
+}
 
-	http.ServeFile(w, r, filePath)
+// Serves the pages, and the articles with a standalone layout, at /<slug>
+func ServePage(w http.ResponseWriter, r *http.Request) {
+	cfg := Site().Config
+	slug := chi.URLParam(r, "slug")
+	if slug != cfg.Language && StringInSlice(slug, cfg.AllLanguages()) {
+		http.Redirect(w, r, "/"+slug+"/", http.StatusMovedPermanently)
+		return
+	}
+	if page, err := Badger.GetPageBySlug(slug); err == nil {
+		allowStyles(w, page.StyleHashes)
+		serveGenerated(w, r, path.Join(cfg.ContentPath, "content", "pages", fmt.Sprintf("%s.html", slug)))
+		return
+	}
+
+	article, ok := Badger.GetIndexedArticle(slug)
+	if !ok || !cfg.Layout(article.Layout).Standalone {
+		NotFound(w, r)
+		return
+	}
+
+	blogPath := fmt.Sprintf("%v/content", cfg.ContentPath)
+	allowStyles(w, article.StyleHashes)
+	serveGenerated(w, r, path.Join(blogPath, fmt.Sprintf("%s.html", slug)))
 }
 
 func GetRawMarkdown(w http.ResponseWriter, r *http.Request) {
@@ -67,9 +144,11 @@ func GetRawMarkdown(w http.ResponseWriter, r *http.Request) {
 
 	// Get article from redis
 	article, err := Badger.GetPostBySlug(slug)
-	if err != nil {
-		log.Err(err).Msg("Error getting article from Redis")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		NotFound(w, r)
+		return
+	} else if err != nil {
+		ServerError(w, r, fmt.Errorf("error getting article from Badger: %v", err))
 		return
 	}
 
@@ -78,71 +157,198 @@ func GetRawMarkdown(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetTagPosts(w http.ResponseWriter, r *http.Request) {
-	tag := chi.URLParam(r, "tag")
-	page := r.URL.Query().Get("p")
-
-	pageNum, _ := strconv.Atoi(page)
-	pageNum = int(math.Max(0, float64(pageNum-1)))
-
-	from := pageNum * 10
-	to := from + 10
+	site := Site()
+	lang, ok := requestLang(w, r)
+	if !ok {
+		return
+	}
+	tag, _ := url.PathUnescape(chi.URLParam(r, "tag"))
+	slug := TagSlug(tag)
+	if slug == "" {
+		NotFound(w, r)
+		return
+	}
+	// Every spelling and alias of a tag redirects to its slug
+	if tag != slug {
+		target := LangPath(lang) + "/t/" + url.PathEscape(slug)
+		if page := chi.URLParam(r, "page"); page != "" {
+			target += "/page/" + page
+		}
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+		return
+	}
+	path := LangPath(lang) + "/t/" + url.PathEscape(slug)
+	page, ok := requestPage(w, r, path)
+	if !ok {
+		return
+	}
 
-	articles := Badger.GetAllArticles()
+	articles := ListedArticles(lang)
 	tagArticles := make([]ArticleData, 0, len(articles))
 	for _, article := range articles {
-		if StringInSlice(tag, article.Tags) {
+		if StringInSlice(slug, ArticleTags(article)) {
 			tagArticles = append(tagArticles, article)
 		}
 	}
 
-	sort.Slice(tagArticles, func(i, j int) bool {
-		return tagArticles[i].Date.After(tagArticles[j].Date)
-	})
-
-	totalPages := int(math.Ceil(float64(len(tagArticles)) / 10.0))
+	paginator, ok := NewPaginator(len(tagArticles), page, path)
+	if !ok || len(tagArticles) == 0 {
+		NotFound(w, r)
+		return
+	}
 
-	if to > len(tagArticles) {
-		to = len(tagArticles)
+	info := GetTag(slug)
+	for _, t := range AllTags(lang) {
+		if t.Slug == slug {
+			info = t
+		}
 	}
-	log.Debug().Msgf("From: %d - To: %d", from, to)
-	pagedArticles := tagArticles[from:to]
 
 	varmap := map[string]interface{}{
-		"Articles":   pagedArticles,
-		"Blogo":      Blogo,
-		"Tag":        tag,
-		"Page":       pageNum,
-		"TotalPages": totalPages,
+		"Articles":    paginator.Articles(tagArticles),
+		"Blogo":       site.Config,
+		"Data":        site.Data,
+		"Lang":        lang,
+		"Tag":         info.Name,
+		"TagSlug":     slug,
+		"Description": info.Description,
+		"Page":        paginator.Page,
+		"TotalPages":  paginator.TotalPages,
+		"Paginator":   paginator,
 	}
 
-	if err := TagTmpl.ExecuteTemplate(w, "base", varmap); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	render(w, r, site.Templates.Tag, varmap)
+}
+
+// Lists all the tags of a language with their number of articles
+func GetTags(w http.ResponseWriter, r *http.Request) {
+	site := Site()
+	lang, ok := requestLang(w, r)
+	if !ok {
+		return
+	}
+
+	varmap := map[string]interface{}{
+		"Tags":  AllTags(lang),
+		"Blogo": site.Config,
+		"Data":  site.Data,
+		"Lang":  lang,
 	}
+
+	render(w, r, site.Templates.Tags, varmap)
 }
 
-func GetAbout(w http.ResponseWriter, r *http.Request) {
+// Lists the posts by year and month, at /archive, /archive/<year> and
+// /archive/<year>/<month>
+func GetArchive(w http.ResponseWriter, r *http.Request) {
+	site := Site()
+	lang, ok := requestLang(w, r)
+	if !ok {
+		return
+	}
+
+	years := Archive(lang)
+	total := 0
+	for _, y := range years {
+		total += y.Count
+	}
+
+	year, month := 0, 0
+	if param := chi.URLParam(r, "year"); param != "" {
+		var err error
+		if year, err = strconv.Atoi(param); err != nil {
+			NotFound(w, r)
+			return
+		}
+		if param := chi.URLParam(r, "month"); param != "" {
+			if month, err = strconv.Atoi(param); err != nil || month < 1 || month > 12 {
+				NotFound(w, r)
+				return
+			}
+		}
+		years = FilterArchive(years, year, time.Month(month))
+		if len(years) == 0 {
+			NotFound(w, r)
+			return
+		}
+	}
+
 	varmap := map[string]interface{}{
-		"About": About.Data,
-		"Blogo": Blogo,
+		"Years": years,
+		"Year":  year,
+		"Month": time.Month(month),
+		"Total": total,
+		"Blogo": site.Config,
+		"Data":  site.Data,
+		"Lang":  lang,
 	}
-	// Execute the template from templates.go
-	if err := AboutTmpl.ExecuteTemplate(w, "base", varmap); err != nil {
-		log.Error().Err(err).Msg("Error executing template:")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+	render(w, r, site.Templates.Archive, varmap)
+}
+
+func GetHealth(w http.ResponseWriter, r *http.Request) {
+	slugs, _ := Badger.GetAllArticleSlugs()
+	errors := GetLoadErrors()
+	status := "ok"
+	if len(errors) > 0 {
+		status = "degraded"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   status,
+		"articles": len(slugs),
+		"errors":   errors,
+	})
+}
+
+// Reports whether the articles are loaded and the site can take traffic
+func GetReady(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !ready.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "loading"})
+		return
 	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "ready"})
+}
+
+// Serves the static files of the current theme, and the user's ones
+func ServeStatic(w http.ResponseWriter, r *http.Request) {
+	http.FileServer(http.FS(Site().Theme.Static())).ServeHTTP(w, r)
+}
+
+func HandleChromaCss(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/css")
+	w.Write(Site().ChromaCss)
 }
 
 func HandleRssFeed(w http.ResponseWriter, r *http.Request) {
+	lang, ok := requestLang(w, r)
+	if !ok {
+		return
+	}
 	w.Header().Set("Content-Type", "application/rss+xml")
-	w.Write([]byte(RssFeed()))
+	w.Write([]byte(RssFeed(lang)))
 }
 
 func HandleAtomFeed(w http.ResponseWriter, r *http.Request) {
+	lang, ok := requestLang(w, r)
+	if !ok {
+		return
+	}
 	w.Header().Set("Content-Type", "application/atom+xml")
-	w.Write([]byte(AtomFeed()))
+	w.Write([]byte(AtomFeed(lang)))
 }
 
 func HandleJsonFeed(w http.ResponseWriter, r *http.Request) {
+	lang, ok := requestLang(w, r)
+	if !ok {
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(JsonFeed()))
+	w.Write([]byte(JsonFeed(lang)))
 }
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Merges the i18n files of all the theme layers, so a file in the content
+// folder only needs the strings it changes.
+func loadI18n(theme ThemeFS) (map[string]map[string]string, error) {
+	strs := map[string]map[string]string{}
+	for i := len(theme) - 1; i >= 0; i-- {
+		files, _ := fs.Glob(theme[i], "i18n/*.yaml")
+		for _, file := range files {
+			lang, _ := ParseFilePath(file)
+			content, err := fs.ReadFile(theme[i], file)
+			if err != nil {
+				return nil, err
+			}
+			var values map[string]string
+			if err := yaml.Unmarshal(content, &values); err != nil {
+				return nil, fmt.Errorf("error parsing %v: %v", file, err)
+			}
+			if strs[lang] == nil {
+				strs[lang] = map[string]string{}
+			}
+			for key, value := range values {
+				strs[lang][key] = value
+			}
+		}
+	}
+	return strs, nil
+}
+
+// Returns the UI string for a key in the given language. Missing strings
+// fall back to the base language (es for es-AR), the site language, English
+// and finally the key itself. Arguments are formatted into the string.
+func Translate(key, lang string, args ...interface{}) string {
+	site := Site()
+	base, _, _ := strings.Cut(lang, "-")
+	for _, l := range []string{lang, base, site.Config.Language, "en"} {
+		if value, ok := site.I18n[l][key]; ok {
+			if len(args) > 0 {
+				return fmt.Sprintf(value, args...)
+			}
+			return value
+		}
+	}
+	return key
+}
+
+// Formats a date with the date_format and months of a language
+func FormatDate(t time.Time, lang string) string {
+	layout := Translate("date_format", lang)
+	if layout == "date_format" {
+		layout = "2006-01-02"
+	}
+
+	// Go only knows the English month names
+	if !strings.Contains(layout, "January") {
+		return t.Format(layout)
+	}
+	layout = strings.Replace(layout, "January", "\x00", 1)
+	return strings.Replace(t.Format(layout), "\x00", MonthName(t.Month(), lang), 1)
+}
+
+// Returns the name of a month in a language
+func MonthName(month time.Month, lang string) string {
+	months := strings.Split(Translate("month_names", lang), ",")
+	if len(months) != 12 {
+		return month.String()
+	}
+	return strings.TrimSpace(months[month-1])
+}
+
+// Returns how long ago a date was, like "3 days ago"
+func TimeAgo(t time.Time, lang string) string {
+	d := time.Since(t)
+	if d < time.Minute {
+		return Translate("just_now", lang)
+	}
+
+	units := []struct {
+		size time.Duration
+		name string
+	}{
+		{365 * 24 * time.Hour, "year"},
+		{30 * 24 * time.Hour, "month"},
+		{24 * time.Hour, "day"},
+		{time.Hour, "hour"},
+		{time.Minute, "minute"},
+	}
+	for _, unit := range units {
+		if n := int(d / unit.size); n >= 1 {
+			name := unit.name
+			if n > 1 {
+				name += "s"
+			}
+			return Translate("time_ago", lang, fmt.Sprintf("%d %v", n, Translate(name, lang)))
+		}
+	}
+	return Translate("just_now", lang)
+}
+
+// Returns the other languages of an article, including itself, from the
+// articles that share its TranslationKey
+func ArticleTranslations(article ArticleData) []ArticleData {
+	if article.TranslationKey == "" {
+		return nil
+	}
+	var translations []ArticleData
+	for _, a := range Badger.GetArticleIndex() {
+		if a.TranslationKey == article.TranslationKey {
+			translations = append(translations, a)
+		}
+	}
+	if len(translations) < 2 {
+		return nil
+	}
+	sort.Slice(translations, func(i, j int) bool {
+		return translations[i].Lang < translations[j].Lang
+	})
+	return translations
+}
+
+// Returns the URL prefix of a language, empty for the site language
+func LangPath(lang string) string {
+	if lang == "" || lang == Site().Config.Language {
+		return ""
+	}
+	return "/" + lang
+}
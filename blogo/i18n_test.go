@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Uses the UI strings of the default theme for a test
+func withI18n(t *testing.T) {
+	t.Helper()
+	withContent(t, nil)
+	theme, err := LoadTheme("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	i18n, err := loadI18n(theme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := Site()
+	UpdateSite(func(s *siteState) { s.I18n = i18n })
+	t.Cleanup(func() { site.Store(previous) })
+}
+
+func TestTranslate(t *testing.T) {
+	withI18n(t)
+	withConfig(t, func(c *Config) { c.Language = "de" })
+	tests := []struct {
+		key, lang string
+		args      []interface{}
+		want      string
+	}{
+		{"home", "es", nil, "Inicio"},
+		// es-AR falls back to es, unknown languages to the site language
+		{"home", "es-AR", nil, "Inicio"},
+		{"home", "xx", nil, "Start"},
+		{"tag", "es", []interface{}{"go"}, "etiqueta: #go"},
+		{"missing_key", "es", nil, "missing_key"},
+	}
+	for _, tt := range tests {
+		if got := Translate(tt.key, tt.lang, tt.args...); got != tt.want {
+			t.Errorf("Translate(%q, %q) = %q, want %q", tt.key, tt.lang, got, tt.want)
+		}
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	withI18n(t)
+	date := time.Date(2024, 3, 7, 10, 30, 0, 0, time.UTC)
+	tests := map[string]string{
+		"en": "March 7, 2024",
+		"es": "7 de marzo de 2024",
+	}
+	for lang, want := range tests {
+		if got := FormatDate(date, lang); got != want {
+			t.Errorf("FormatDate in %v = %q, want %q", lang, got, want)
+		}
+	}
+}
+
+func TestLangPath(t *testing.T) {
+	withConfig(t, func(c *Config) { c.Language, c.Languages = "en", []string{"es"} })
+	tests := map[string]string{"": "", "en": "", "es": "/es"}
+	for lang, want := range tests {
+		if got := LangPath(lang); got != want {
+			t.Errorf("LangPath(%q) = %q, want %q", lang, got, want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"html/template"
+	"testing"
+)
+
+func TestConfigLayout(t *testing.T) {
+	withConfig(t, func(c *Config) {
+		c.Layouts = map[string]LayoutConfig{
+			"note":    {},
+			"project": {Standalone: true},
+		}
+	})
+	tests := map[string]LayoutConfig{
+		"":        {Listed: true},
+		"post":    {Listed: true},
+		"page":    {Standalone: true},
+		"note":    {},
+		"project": {Standalone: true},
+		"unknown": {Listed: true},
+	}
+	for name, want := range tests {
+		if got := Site().Config.Layout(name); got != want {
+			t.Errorf("Layout(%q) = %+v, want %+v", name, got, want)
+		}
+	}
+}
+
+func TestArticlePath(t *testing.T) {
+	withConfig(t, func(c *Config) { c.Layouts = nil })
+	tests := map[string]string{
+		"":     "/p/hello",
+		"link": "/p/hello",
+		"page": "/hello",
+	}
+	for layout, want := range tests {
+		if got := ArticlePath(ArticleData{Slug: "hello", Layout: layout}); got != want {
+			t.Errorf("ArticlePath with layout %q = %v, want %v", layout, got, want)
+		}
+	}
+}
+
+func TestTemplatesArticle(t *testing.T) {
+	post, note := template.New("post"), template.New("note")
+	templates := Templates{Post: post, Layouts: map[string]*template.Template{"note": note}}
+	tests := map[string]*template.Template{
+		"":        post,
+		"note":    note,
+		"missing": post,
+	}
+	for layout, want := range tests {
+		if got := templates.Article(ArticleData{Layout: layout}); got != want {
+			t.Errorf("Article with layout %q = %v, want %v", layout, got.Name(), want.Name())
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Logging settings, read from the `log` section of the config file
+type LogConfig struct {
+	// console, for people, or json, one object per line for log aggregators
+	Format string `yaml:"format" toml:"format"`
+	// debug, info, warn or error. Dev mode always logs at the debug level.
+	Level string `yaml:"level" toml:"level"`
+}
+
+func DefaultLogConfig() LogConfig {
+	return LogConfig{Format: "console", Level: "info"}
+}
+
+func init() {
+	// Every JSON line has a time, a level and a message, and the lines of a
+	// subsystem or a request carry a subsystem or request_id field
+	zerolog.TimeFieldFormat = "2006-01-02T15:04:05.000Z07:00"
+	zerolog.DurationFieldUnit = time.Millisecond
+}
+
+// Sets up the global logger from the config, before the server starts
+func InitLogger() {
+	cfg := Site().Config
+	var logger zerolog.Logger
+	if cfg.Log.Format == "json" {
+		logger = zerolog.New(os.Stderr)
+	} else {
+		logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: "15:04:05"})
+	}
+	context := logger.With().Timestamp()
+	if cfg.Dev {
+		context = context.Caller()
+	}
+	log.Logger = context.Logger()
+	// Used by zerolog.Ctx outside of a request
+	zerolog.DefaultContextLogger = &log.Logger
+	SetLogLevel()
+}
+
+// Applies the log level of the config. Unlike the logger, it can change
+// while the server is running.
+func SetLogLevel() {
+	cfg := Site().Config
+	level, err := zerolog.ParseLevel(cfg.Log.Level)
+	if err != nil || cfg.Log.Level == "" {
+		level = zerolog.InfoLevel
+	}
+	if cfg.Dev {
+		level = zerolog.DebugLevel
+	}
+	zerolog.SetGlobalLevel(level)
+}
+
+// Returns the logger of a subsystem, like the watcher, nostr or render,
+// which tags its lines with a subsystem field
+func Log(subsystem string) *zerolog.Logger {
+	logger := log.With().Str("subsystem", subsystem).Logger()
+	return &logger
+}
+
+// Logs every request in one line with its request ID, which is also sent
+// back in the X-Request-Id header. The handlers get a logger with the
+// request ID from zerolog.Ctx.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := middleware.GetReqID(r.Context())
+		w.Header().Set("X-Request-Id", id)
+		logger := Log("http").With().Str("request_id", id).Logger()
+		r = r.WithContext(logger.WithContext(r.Context()))
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		route := ""
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			route = rctx.RoutePattern()
+		}
+		logger.Info().
+			Str("method", r.Method).
+			Str("path", r.URL.RequestURI()).
+			Str("route", route).
+			Int("status", status).
+			Int("bytes", ww.BytesWritten()).
+			Dur("duration", time.Since(start)).
+			Str("remote_ip", remoteIP(r)).
+			Str("user_agent", r.UserAgent()).
+			Msg("request")
+	})
+}
+
+// Returns the IP address of the client, without the port of RemoteAddr
+func remoteIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestRemoteIP(t *testing.T) {
+	tests := map[string]string{
+		"192.0.2.1:1234":    "192.0.2.1",
+		"[2001:db8::1]:443": "2001:db8::1",
+		"192.0.2.1":         "192.0.2.1",
+		"@":                 "@",
+		"":                  "",
+	}
+	for addr, want := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = addr
+		if got := remoteIP(r); got != want {
+			t.Errorf("remoteIP(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
+
+func TestSetLogLevel(t *testing.T) {
+	t.Cleanup(func() { zerolog.SetGlobalLevel(zerolog.InfoLevel) })
+	tests := []struct {
+		level string
+		dev   bool
+		want  zerolog.Level
+	}{
+		{"warn", false, zerolog.WarnLevel},
+		{"", false, zerolog.InfoLevel},
+		{"error", true, zerolog.DebugLevel},
+	}
+	for _, tt := range tests {
+		withConfig(t, func(c *Config) { c.Log.Level, c.Dev = tt.level, tt.dev })
+		SetLogLevel()
+		if got := zerolog.GlobalLevel(); got != tt.want {
+			t.Errorf("SetLogLevel with %q and dev %v = %v, want %v", tt.level, tt.dev, got, tt.want)
+		}
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var out bytes.Buffer
+	logger := log.Logger
+	t.Cleanup(func() { log.Logger = logger })
+	log.Logger = zerolog.New(&out)
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(AccessLog)
+	r.Get("/p/{slug}", func(w http.ResponseWriter, r *http.Request) {
+		zerolog.Ctx(r.Context()).Info().Msg("handler")
+		w.WriteHeader(http.StatusTeapot)
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/p/hello", nil))
+
+	id := w.Header().Get("X-Request-Id")
+	if id == "" {
+		t.Fatal("no X-Request-Id header")
+	}
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("logged %q, want the handler line and the request line", out.String())
+	}
+	for _, line := range lines {
+		var entry map[string]interface{}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry["request_id"] != id || entry["subsystem"] != "http" {
+			t.Errorf("line %s without the request ID %v and the http subsystem", line, id)
+		}
+	}
+	var request map[string]interface{}
+	json.Unmarshal(lines[1], &request)
+	if request["route"] != "/p/{slug}" || request["status"] != float64(http.StatusTeapot) || request["remote_ip"] != "192.0.2.1" {
+		t.Errorf("request line %s", lines[1])
+	}
+}
+
+// The secret key of a generated key pair is printed once to stderr and never
+// logged
+func TestGeneratedNsecNotLogged(t *testing.T) {
+	var out bytes.Buffer
+	logger := log.Logger
+	t.Cleanup(func() { log.Logger = logger })
+	log.Logger = zerolog.New(&out)
+
+	stderr, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := os.Stderr
+	os.Stderr = stderr
+	t.Cleanup(func() { os.Stderr = previous })
+	sk, pk, relays := nostrSk, nostrPk, relayList
+	t.Cleanup(func() { nostrSk, nostrPk, relayList = sk, pk, relays })
+
+	withConfig(t, func(c *Config) { c.Nostr.Nsec = "" })
+	if err := InitNostr(); err != nil {
+		t.Fatal(err)
+	}
+	printed, err := os.ReadFile(stderr.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	nsec, err := nip19.EncodePrivateKey(nostrSk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Count(printed, []byte(nsec)) != 1 {
+		t.Errorf("stderr = %q, want the nsec once", printed)
+	}
+	if bytes.Contains(out.Bytes(), []byte(nsec)) || bytes.Contains(out.Bytes(), []byte(nostrSk)) {
+		t.Errorf("the secret key was logged: %q", out.String())
+	}
+}
@@ -1,28 +1,33 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
-	"github.com/rs/cors"
-	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v2"
 )
 
 func main() {
-	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
-	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	InitLogger()
 
 	dev := flag.Bool("dev", false, "sets dev mode")
 	new := flag.String("new", "", "Creates a new post file in articles/ with the name specified after the flag. Example: -new my-post")
 	path := flag.String("path", "", "Sets the path to the content folder. Example: -path /home/user/my-blog/articles")
 	nkeys := flag.Bool("nkeys", false, "Generates a new nostr key set.")
 	port := flag.Int("port", 3000, "Sets the port to run the server on. Example: -port 3000")
+	check := flag.Bool("check", false, "Validates the metadata of all articles and exits with a non-zero code if any problem is found.")
+	configFile := flag.String("config", "", "Sets the config file to use. Defaults to blogo.yaml, blogo.yml or blogo.toml in the content folder.")
+	printConfig := flag.Bool("print-config", false, "Prints the effective configuration, with secrets redacted, and exits.")
 	flag.Parse()
 
 	if *nkeys {
@@ -35,132 +40,174 @@ func main() {
 		os.Exit(0)
 	}
 
-	if *dev {
-		os.Setenv("DEV", "true")
-		//os.Setenv("CONTENT_PATH", "..")
-		os.Setenv("DEV", "true")
-		log.Logger = log.Output(
-			zerolog.ConsoleWriter{
-				Out:        os.Stdout,
-				TimeFormat: "15:04:05",
-			},
-		).With().Caller().Logger()
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
-	}
-
-	if *path != "" {
-		log.Info().Msgf("Using path: %v", *path)
-		os.Setenv("CONTENT_PATH", *path)
-	} else {
-		if os.Getenv("CONTENT_PATH") == "" {
-			log.Warn().Msg("No path specified, using default path: ./")
-			os.Setenv("CONTENT_PATH", ".")
-		}
+	// The content path is needed first to find the .env and config files
+	contentPath := *path
+	if contentPath == "" {
+		contentPath = os.Getenv("CONTENT_PATH")
+	}
+	if contentPath == "" {
+		log.Warn().Msg("No path specified, using default path: ./")
+		contentPath = "."
 	}
 
-	if strings.HasSuffix(os.Getenv("CONTENT_PATH"), "/") {
-		os.Setenv("CONTENT_PATH", os.Getenv("CONTENT_PATH")[:len(*path)-1])
+	// Load .env file
+	EnvFile = fmt.Sprintf("%v/.env", strings.TrimSuffix(contentPath, "/"))
+	err := godotenv.Load(EnvFile)
+	if err != nil {
+		log.Warn().Msg("No .env file found, using default settings or environment variables.")
+	}
+
+	// Settings precedence: config file < environment < flags
+	ConfigFile = FindConfigFile(*configFile, contentPath)
+	configOverrides = func(cfg *Config) {
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "path":
+				cfg.ContentPath = *path
+			case "port":
+				cfg.Port = *port
+			case "dev":
+				cfg.Dev = *dev
+			}
+		})
+	}
+	cfg, err := ResolveConfig()
+	if err != nil {
+		log.Fatal().Msgf("Failed to load configuration: %v", err)
+	}
+	UpdateSite(func(s *siteState) { s.Config = cfg })
+
+	if *printConfig {
+		out, err := yaml.Marshal(cfg.Redacted())
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to print configuration")
+		}
+		fmt.Print(string(out))
+		os.Exit(0)
 	}
 
 	if *new != "" {
-		CreateArticleTemplate(*new)
+		if err := CreateArticleTemplate(*new); err != nil {
+			log.Fatal().Err(err).Msg("Could not create new template")
+		}
 		log.Info().Msgf("New template created: articles/%v.md", *new)
 		os.Exit(0)
 	}
 
-	// Load .env file
-	err := godotenv.Load(fmt.Sprintf("%v/.env", os.Getenv("CONTENT_PATH")))
-	if err != nil {
-		log.Warn().Msg("No .env file found, using default settings or environment variables.")
+	if *check {
+		checked, problems := CheckArticles()
+		for _, problem := range problems {
+			fmt.Println(problem.Error())
+		}
+		if len(problems) > 0 {
+			log.Error().Msgf("Found %v problems in %v articles", len(problems), checked)
+			os.Exit(1)
+		}
+		log.Info().Msgf("Checked %v articles, no problems found", checked)
+		os.Exit(0)
 	}
 
+	// Canceled on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	AppContext = ctx
+
 	InitSettings()
 	InitBadger()
 	//InitRedis()
-	InitTemplates()
+	if err := InitTemplates(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to load templates")
+	}
 	r := InitRoutes()
 
-	c := cors.New(cors.Options{
-		AllowedOrigins: []string{"*"},
-		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodDelete, http.MethodPatch},
-	})
-
-	handler := c.Handler(r)
-
-	if os.Getenv("PUBLISH_TO_NOSTR") == "true" {
+	if cfg.Nostr.Publish {
 		err = InitNostr()
 		if err != nil {
 			log.Error().Err(err).Msg("Error initializing nostr:")
 		}
 	}
 
+	server := &http.Server{
+		Addr:         fmt.Sprintf(":%v", cfg.Port),
+		Handler:      r,
+		ReadTimeout:  time.Duration(cfg.Server.ReadTimeout),
+		WriteTimeout: time.Duration(cfg.Server.WriteTimeout),
+		IdleTimeout:  time.Duration(cfg.Server.IdleTimeout),
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+	log.Info().Msgf("Starting server on port %v...", cfg.Port)
+
+	// The server is not ready, see /readyz, until the articles are loaded
 	err = LoadArticles()
 	if err != nil {
 		log.Error().Err(err).Msg("Error loading articles metadata:")
 	}
+	ready.Store(true)
 
-	go InitWatcher()
-
-	log.Info().Msgf("Starting server on port %v...", *port)
-	http.ListenAndServe(fmt.Sprintf(":%v", *port), handler)
-}
-
-func InitSettings() {
-	if os.Getenv("BLOGO_DESCRIPTION") != "false" {
-		if os.Getenv("BLOGO_DESCRIPTION") == "" {
-			Blogo.Description = "Welcome to my Blogo 🎈"
-		} else {
-			Blogo.Description = os.Getenv("BLOGO_DESCRIPTION")
+	var background sync.WaitGroup
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		if err := InitWatcher(ctx); err != nil {
+			log.Error().Err(err).Msg("File watcher stopped, changes will not be reloaded")
 		}
-	}
+	}()
 
-	if os.Getenv("BLOGO_TITLE") != "" {
-		Blogo.Title = os.Getenv("BLOGO_TITLE")
-	} else {
-		Blogo.Title = "Blogo"
+	exitCode := 0
+	select {
+	case err := <-serverErr:
+		log.Error().Err(err).Msg("Server stopped")
+		exitCode = 1
+	case <-ctx.Done():
+		log.Info().Msg("Shutting down, waiting for in-flight requests...")
 	}
+	// Stops the watcher and any Nostr publishing
+	stop()
 
-	if os.Getenv("BLOGO_URL") != "" {
-		Blogo.Url = os.Getenv("BLOGO_URL")
-		Blogo.Url = strings.TrimSuffix(Blogo.Url, "/")
-	} else {
-		Blogo.Url = "http://localhost:3000"
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(Site().Config.Server.ShutdownTimeout))
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("Could not finish all the requests in time")
+		exitCode = 1
 	}
+	background.Wait()
 
-	if os.Getenv("BLOGO_KEYWORDS") != "" {
-		Blogo.Keywords = os.Getenv("BLOGO_KEYWORDS")
-	} else {
-		Blogo.Keywords = "blog, blogo"
-	}
-
-	if os.Getenv("BLOGO_ANALYTICS") != "" {
-		Blogo.Analytics = os.Getenv("BLOGO_ANALYTICS")
-	}
-
-	if os.Getenv("TIMEZONE") == "" {
-		Blogo.Timezone = "UTC"
-
-	} else {
-		Blogo.Timezone = os.Getenv("TIMEZONE")
+	if err := Badger.Close(); err != nil {
+		log.Error().Err(err).Msg("Error closing the database")
+		exitCode = 1
 	}
+	log.Info().Msg("Bye!")
+	os.Exit(exitCode)
+}
 
-	location, err := time.LoadLocation(Blogo.Timezone)
-	if err != nil {
-		log.Fatal().Err(err).Msgf("Failed to load timezone location '%s'", Blogo.Timezone)
-	}
-	time.Local = location
+// Canceled when Blogo shuts down, to stop the background work
+var AppContext = context.Background()
 
+// Applies the loaded settings
+func InitSettings() {
+	InitLogger()
 	LogSettings()
 }
 
 func LogSettings() {
-	log.Info().Msg("Loaded settings:")
-	log.Info().Msgf("\t~ Title: %v", Blogo.Title)
-	log.Info().Msgf("\t~ Description: %v", Blogo.Description)
-	log.Info().Msgf("\t~ Url: %v", Blogo.Url)
-	log.Info().Msgf("\t~ Keywords: %v", Blogo.Keywords)
-	log.Info().Msgf("\t~ Timezone: %v", Blogo.Timezone)
-	if Blogo.Analytics != "" {
-		log.Info().Msgf("\t~ Analytics: yes\n")
-	}
+	cfg := Site().Config
+	log.Info().
+		Str("content_path", cfg.ContentPath).
+		Str("title", cfg.Title).
+		Str("description", cfg.Description).
+		Str("url", cfg.Url).
+		Str("keywords", cfg.Keywords).
+		Str("timezone", cfg.Timezone).
+		Str("permalink", cfg.Permalink).
+		Bool("math", cfg.Markdown.Math).
+		Bool("diagrams", cfg.Markdown.Diagrams).
+		Bool("admonitions", cfg.Markdown.Admonitions).
+		Bool("emoji", cfg.Markdown.Emoji).
+		Str("highlight_style", cfg.Markdown.HighlightStyle+"/"+cfg.Markdown.HighlightStyleDark).
+		Bool("nostr", cfg.Nostr.Publish).
+		Bool("analytics", cfg.Analytics != "").
+		Msg("Loaded settings")
 }
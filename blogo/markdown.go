@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	gohtml "html"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/yuin/goldmark"
+	emoji "github.com/yuin/goldmark-emoji"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	meta "github.com/yuin/goldmark-meta"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+)
+
+var markdown goldmark.Markdown
+
+// Options for the Markdown rendering pipeline, read from the `markdown`
+// section of the config file. Everything is rendered server-side.
+type MarkdownConfig struct {
+	GFM            bool   `yaml:"gfm" toml:"gfm"`
+	Footnotes      bool   `yaml:"footnotes" toml:"footnotes"`
+	HardWraps      bool   `yaml:"hard_wraps" toml:"hard_wraps"`
+	Typographer    bool   `yaml:"typographer" toml:"typographer"`
+	DefinitionList bool   `yaml:"definition_list" toml:"definition_list"`
+	Emoji          bool   `yaml:"emoji" toml:"emoji"`
+	Admonitions    bool   `yaml:"admonitions" toml:"admonitions"`
+	Math           bool   `yaml:"math" toml:"math"`
+	Diagrams       bool   `yaml:"diagrams" toml:"diagrams"`
+	MermaidCmd     string `yaml:"mermaid_cmd" toml:"mermaid_cmd"`
+	GraphvizCmd    string `yaml:"graphviz_cmd" toml:"graphviz_cmd"`
+	// Code blocks are highlighted with CSS classes. The light and dark
+	// styles are served in /static/chroma.css under prefers-color-scheme.
+	HighlightStyle     string `yaml:"highlight_style" toml:"highlight_style"`
+	HighlightStyleDark string `yaml:"highlight_style_dark" toml:"highlight_style_dark"`
+	LineNumbers        bool   `yaml:"line_numbers" toml:"line_numbers"`
+}
+
+func DefaultMarkdownConfig() MarkdownConfig {
+	return MarkdownConfig{
+		GFM:                true,
+		Footnotes:          true,
+		HardWraps:          true,
+		MermaidCmd:         "mmdc",
+		GraphvizCmd:        "dot",
+		HighlightStyle:     "github",
+		HighlightStyleDark: "monokai",
+		LineNumbers:        true,
+	}
+}
+
+func InitGoldmark() {
+	cfg := Site().Config.Markdown
+
+	extensions := []goldmark.Extender{
+		meta.Meta,
+		highlighting.NewHighlighting(
+			highlighting.WithFormatOptions(
+				chromahtml.WithClasses(true),
+				chromahtml.WithLineNumbers(cfg.LineNumbers),
+			),
+			highlighting.WithWrapperRenderer(codeBlockWrapper),
+		),
+	}
+	if cfg.GFM {
+		extensions = append(extensions, extension.GFM)
+	}
+	if cfg.Footnotes {
+		extensions = append(extensions, extension.Footnote)
+	}
+	if cfg.Typographer {
+		extensions = append(extensions, extension.Typographer)
+	}
+	if cfg.DefinitionList {
+		extensions = append(extensions, extension.DefinitionList)
+	}
+	if cfg.Emoji {
+		extensions = append(extensions, emoji.Emoji)
+	}
+	if cfg.Admonitions {
+		extensions = append(extensions, Admonitions)
+	}
+	if cfg.Math {
+		extensions = append(extensions, Math)
+	}
+	if cfg.Diagrams {
+		extensions = append(extensions, &Diagrams{
+			MermaidCmd:  cfg.MermaidCmd,
+			GraphvizCmd: cfg.GraphvizCmd,
+		})
+	}
+
+	rendererOptions := []renderer.Option{html.WithXHTML()}
+	if cfg.HardWraps {
+		rendererOptions = append(rendererOptions, html.WithHardWraps())
+	}
+
+	css, err := GenerateChromaCss(cfg.HighlightStyle, cfg.HighlightStyleDark)
+	if err != nil {
+		Log("render").Error().Err(err).Msg("Error generating syntax highlighting CSS")
+	}
+	UpdateSite(func(s *siteState) { s.ChromaCss = css })
+	fingerprints.Delete("chroma.css")
+
+	markdown = goldmark.New(
+		goldmark.WithExtensions(extensions...),
+		goldmark.WithParserOptions(
+			parser.WithAutoHeadingID(),
+		),
+		goldmark.WithRendererOptions(rendererOptions...),
+	)
+}
+
+// Generates the CSS classes for both highlighting styles, the dark one being
+// applied when the reader's system prefers a dark color scheme.
+func GenerateChromaCss(light, dark string) ([]byte, error) {
+	formatter := chromahtml.New(chromahtml.WithClasses(true), chromahtml.WithLineNumbers(true))
+
+	var buf bytes.Buffer
+	for _, name := range []string{light, dark} {
+		if _, ok := styles.Registry[name]; !ok {
+			Log("render").Warn().Msgf("Unknown highlighting style %v, using fallback style", name)
+		}
+	}
+	if err := formatter.WriteCSS(&buf, styles.Get(light)); err != nil {
+		return nil, err
+	}
+	buf.WriteString("@media (prefers-color-scheme: dark) {\n")
+	if err := formatter.WriteCSS(&buf, styles.Get(dark)); err != nil {
+		return nil, err
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
+
+// Wraps code blocks in a <figure> with a caption when a filename is given in
+// the fence attributes, e.g. ```go {filename="main.go" hl_lines=[2,"4-6"]}
+func codeBlockWrapper(w util.BufWriter, ctx highlighting.CodeBlockContext, entering bool) {
+	var filename string
+	if attrs := ctx.Attributes(); attrs != nil {
+		if value, ok := attrs.Get([]byte("filename")); ok {
+			if v, ok := value.([]byte); ok {
+				filename = string(v)
+			}
+		}
+	}
+
+	if entering {
+		if filename != "" {
+			w.WriteString("<figure class=\"code-block\">")
+			w.WriteString(fmt.Sprintf("<figcaption>%v</figcaption>", gohtml.EscapeString(filename)))
+		}
+		if !ctx.Highlighted() {
+			w.WriteString("<pre><code")
+			if lang, ok := ctx.Language(); ok {
+				w.WriteString(fmt.Sprintf(" class=\"language-%v\"", gohtml.EscapeString(string(lang))))
+			}
+			w.WriteString(">")
+		}
+		return
+	}
+
+	if !ctx.Highlighted() {
+		w.WriteString("</code></pre>\n")
+	}
+	if filename != "" {
+		w.WriteString("</figure>\n")
+	}
+}
+
+// Converts a markdown snippet to HTML with the configured pipeline.
+func ConvertMarkdown(md []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := markdown.Convert(md, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,608 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Math is a goldmark extension that renders $inline$ and $$display$$ TeX
+// expressions to MathML at build time, so no JavaScript is needed to read them.
+var Math = &mathExtension{}
+
+var KindMathInline = ast.NewNodeKind("MathInline")
+var KindMathBlock = ast.NewNodeKind("MathBlock")
+
+type MathInline struct {
+	ast.BaseInline
+	Display bool
+	Source  []byte
+}
+
+func (n *MathInline) Kind() ast.NodeKind { return KindMathInline }
+
+func (n *MathInline) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Source": string(n.Source)}, nil)
+}
+
+type MathBlock struct {
+	ast.BaseBlock
+	closed bool
+}
+
+func (n *MathBlock) Kind() ast.NodeKind { return KindMathBlock }
+
+func (n *MathBlock) IsRaw() bool { return true }
+
+func (n *MathBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+type mathExtension struct{}
+
+func (e *mathExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithBlockParsers(util.Prioritized(&mathBlockParser{}, 150)),
+		parser.WithInlineParsers(util.Prioritized(&mathInlineParser{}, 150)),
+	)
+	m.Renderer().AddOptions(
+		renderer.WithNodeRenderers(util.Prioritized(&mathRenderer{}, 150)),
+	)
+}
+
+type mathInlineParser struct{}
+
+var mathNoCloserKey = parser.NewContextKey()
+
+// Where the last scan for a closing delimiter of a line failed, by length of
+// the delimiter. A failed scan found no closer up to the end of the line, so
+// neither would the scans from the next openers of that line, which are
+// skipped. This keeps a line full of unmatched $ linear.
+type mathNoCloser struct {
+	lineEnd int
+	from    [3]int
+}
+
+func (p *mathInlineParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+func (p *mathInlineParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, segment := block.PeekLine()
+	delim := 1
+	if len(line) > 1 && line[1] == '$' {
+		delim = 2
+	}
+	// The opening delimiter must be followed by a non-space character,
+	// otherwise "$5 and $10" would be parsed as math.
+	if len(line) <= delim || unicode.IsSpace(rune(line[delim])) {
+		return nil
+	}
+	failed, _ := pc.Get(mathNoCloserKey).(*mathNoCloser)
+	if failed != nil && failed.lineEnd == segment.Stop && failed.from[delim] >= 0 && segment.Start >= failed.from[delim] {
+		return nil
+	}
+
+	for i := delim; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '$':
+			if delim == 2 && (i+1 >= len(line) || line[i+1] != '$') {
+				continue
+			}
+			if unicode.IsSpace(rune(line[i-1])) {
+				continue
+			}
+			if delim == 1 && i+1 < len(line) && line[i+1] >= '0' && line[i+1] <= '9' {
+				continue
+			}
+			node := &MathInline{
+				Display: delim == 2,
+				Source:  append([]byte(nil), line[delim:i]...),
+			}
+			block.Advance(i + delim)
+			return node
+		}
+	}
+
+	if failed == nil || failed.lineEnd != segment.Stop {
+		failed = &mathNoCloser{lineEnd: segment.Stop, from: [3]int{-1, -1, -1}}
+		pc.Set(mathNoCloserKey, failed)
+	}
+	failed.from[delim] = segment.Start
+	return nil
+}
+
+type mathBlockParser struct{}
+
+func (b *mathBlockParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+func (b *mathBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 || !bytes.HasPrefix(line[pos:], []byte("$$")) {
+		return nil, parser.NoChildren
+	}
+
+	node := &MathBlock{}
+	rest := bytes.TrimSpace(line[pos+2:])
+	if len(rest) == 0 {
+		return node, parser.NoChildren
+	}
+	// Single line display math: $$ x^2 $$
+	if !bytes.HasSuffix(rest, []byte("$$")) || len(rest) < 3 {
+		return nil, parser.NoChildren
+	}
+	start := segment.Start + pos + 2
+	node.Lines().Append(text.NewSegment(start, start+bytes.LastIndex(line[pos+2:], []byte("$$"))))
+	node.closed = true
+	return node, parser.NoChildren
+}
+
+func (b *mathBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	if node.(*MathBlock).closed {
+		return parser.Close
+	}
+	line, segment := reader.PeekLine()
+	if bytes.Equal(bytes.TrimSpace(line), []byte("$$")) {
+		newline := 1
+		if line[len(line)-1] != '\n' {
+			newline = 0
+		}
+		reader.Advance(segment.Len() - newline)
+		return parser.Close
+	}
+	node.Lines().Append(segment)
+	reader.Advance(segment.Len() - 1)
+	return parser.Continue | parser.NoChildren
+}
+
+func (b *mathBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (b *mathBlockParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (b *mathBlockParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+type mathRenderer struct{}
+
+func (r *mathRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindMathInline, r.renderInline)
+	reg.Register(KindMathBlock, r.renderBlock)
+}
+
+func (r *mathRenderer) renderInline(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		n := node.(*MathInline)
+		w.WriteString(TexToMathML(string(n.Source), n.Display))
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *mathRenderer) renderBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		var buf bytes.Buffer
+		lines := node.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			segment := lines.At(i)
+			buf.Write(segment.Value(source))
+		}
+		w.WriteString("<div class=\"math\">")
+		w.WriteString(TexToMathML(buf.String(), true))
+		w.WriteString("</div>\n")
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+// TexToMathML converts a (reasonable subset of) TeX math expression to a
+// MathML <math> element. Unknown commands are kept as <merror> so the author
+// can spot them instead of silently losing content.
+func TexToMathML(src string, display bool) string {
+	p := &texParser{src: []rune(strings.TrimSpace(src)), display: display}
+	body := p.parseRow(0)
+
+	var sb strings.Builder
+	sb.WriteString(`<math xmlns="http://www.w3.org/1998/Math/MathML"`)
+	if display {
+		sb.WriteString(` display="block"`)
+	}
+	sb.WriteString("><semantics><mrow>")
+	sb.WriteString(body)
+	sb.WriteString(`</mrow><annotation encoding="application/x-tex">`)
+	sb.WriteString(html.EscapeString(strings.TrimSpace(src)))
+	sb.WriteString("</annotation></semantics></math>")
+	return sb.String()
+}
+
+var texIdentifiers = map[string]string{
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ϵ", "varepsilon": "ε",
+	"zeta": "ζ", "eta": "η", "theta": "θ", "vartheta": "ϑ", "iota": "ι", "kappa": "κ",
+	"lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ", "pi": "π", "varpi": "ϖ", "rho": "ρ",
+	"varrho": "ϱ", "sigma": "σ", "varsigma": "ς", "tau": "τ", "upsilon": "υ", "phi": "ϕ",
+	"varphi": "φ", "chi": "χ", "psi": "ψ", "omega": "ω",
+	"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ", "Pi": "Π",
+	"Sigma": "Σ", "Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ", "Omega": "Ω",
+	"infty": "∞", "partial": "∂", "nabla": "∇", "hbar": "ℏ", "ell": "ℓ", "emptyset": "∅",
+	"Re": "ℜ", "Im": "ℑ", "aleph": "ℵ",
+}
+
+var texOperators = map[string]string{
+	"pm": "±", "mp": "∓", "times": "×", "div": "÷", "cdot": "⋅", "ast": "∗", "star": "⋆",
+	"circ": "∘", "bullet": "∙", "leq": "≤", "le": "≤", "geq": "≥", "ge": "≥", "neq": "≠",
+	"ne": "≠", "approx": "≈", "equiv": "≡", "sim": "∼", "simeq": "≃", "cong": "≅",
+	"propto": "∝", "ll": "≪", "gg": "≫", "in": "∈", "notin": "∉", "ni": "∋",
+	"subset": "⊂", "subseteq": "⊆", "supset": "⊃", "supseteq": "⊇", "cup": "∪", "cap": "∩",
+	"setminus": "∖", "to": "→", "rightarrow": "→", "leftarrow": "←", "gets": "←",
+	"Rightarrow": "⇒", "Leftarrow": "⇐", "leftrightarrow": "↔", "Leftrightarrow": "⇔",
+	"iff": "⇔", "implies": "⟹", "mapsto": "↦", "forall": "∀", "exists": "∃", "neg": "¬",
+	"lnot": "¬", "land": "∧", "wedge": "∧", "lor": "∨", "vee": "∨", "oplus": "⊕",
+	"otimes": "⊗", "perp": "⊥", "parallel": "∥", "mid": "∣", "cdots": "⋯", "ldots": "…",
+	"dots": "…", "vdots": "⋮", "ddots": "⋱", "langle": "⟨", "rangle": "⟩",
+	"lfloor": "⌊", "rfloor": "⌋", "lceil": "⌈", "rceil": "⌉", "lbrace": "{", "rbrace": "}",
+	"{": "{", "}": "}", "|": "‖", "vert": "|", "Vert": "‖", "prime": "′",
+}
+
+var texLargeOperators = map[string]string{
+	"sum": "∑", "prod": "∏", "coprod": "∐", "int": "∫", "iint": "∬", "iiint": "∭",
+	"oint": "∮", "bigcup": "⋃", "bigcap": "⋂", "bigoplus": "⨁", "bigotimes": "⨂",
+}
+
+var texFunctions = []string{
+	"sin", "cos", "tan", "cot", "sec", "csc", "arcsin", "arccos", "arctan", "sinh",
+	"cosh", "tanh", "log", "ln", "lg", "exp", "det", "dim", "ker", "deg", "gcd", "arg",
+	"hom", "Pr",
+}
+
+var texLimits = []string{"lim", "limsup", "liminf", "max", "min", "sup", "inf"}
+
+var texSpaces = map[string]string{
+	",": "0.1667em", ":": "0.2222em", ">": "0.2222em", ";": "0.2778em", " ": "0.25em",
+	"quad": "1em", "qquad": "2em", "!": "-0.1667em",
+}
+
+var texAccents = map[string]string{
+	"hat": "^", "widehat": "^", "bar": "¯", "overline": "¯", "vec": "→", "dot": "˙",
+	"ddot": "¨", "tilde": "~", "widetilde": "~",
+}
+
+var texFonts = map[string]string{
+	"mathbf": "bold", "mathit": "italic", "mathrm": "normal", "mathbb": "double-struck",
+	"mathcal": "script", "mathfrak": "fraktur", "mathsf": "sans-serif", "mathtt": "monospace",
+	"boldsymbol": "bold-italic", "operatorname": "normal",
+}
+
+type texParser struct {
+	src     []rune
+	pos     int
+	display bool
+}
+
+// Stop tokens used by parseRow to end the current row.
+const (
+	texStopGroup = 1 << iota
+	texStopRight
+	texStopCell
+)
+
+func (p *texParser) skipSpaces() {
+	for p.pos < len(p.src) && unicode.IsSpace(p.src[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *texParser) peekCommand() string {
+	if p.pos >= len(p.src) || p.src[p.pos] != '\\' {
+		return ""
+	}
+	i := p.pos + 1
+	if i < len(p.src) && !unicode.IsLetter(p.src[i]) {
+		return string(p.src[i])
+	}
+	for i < len(p.src) && unicode.IsLetter(p.src[i]) {
+		i++
+	}
+	return string(p.src[p.pos+1 : i])
+}
+
+func (p *texParser) readCommand() string {
+	name := p.peekCommand()
+	p.pos += 1 + len([]rune(name))
+	return name
+}
+
+// Parses atoms until the end of input or a stop token allowed by stops.
+func (p *texParser) parseRow(stops int) string {
+	var sb strings.Builder
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.src) {
+			return sb.String()
+		}
+		c := p.src[p.pos]
+		if c == '}' && stops&texStopGroup != 0 {
+			return sb.String()
+		}
+		if c == '&' && stops&texStopCell != 0 {
+			return sb.String()
+		}
+		if cmd := p.peekCommand(); (cmd == "right" && stops&texStopRight != 0) ||
+			((cmd == "\\" || cmd == "end") && stops&texStopCell != 0) {
+			return sb.String()
+		}
+		sb.WriteString(p.parseScripts())
+	}
+}
+
+// Parses an atom and any sub/superscripts attached to it.
+func (p *texParser) parseScripts() string {
+	base, large := p.parseAtom()
+	var sub, sup string
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.src) {
+			break
+		}
+		if p.src[p.pos] == '_' && sub == "" {
+			p.pos++
+			sub = p.parseArgument()
+		} else if p.src[p.pos] == '^' && sup == "" {
+			p.pos++
+			sup = p.parseArgument()
+		} else if p.src[p.pos] == '\'' {
+			p.pos++
+			sup += "<mo>′</mo>"
+		} else {
+			break
+		}
+	}
+
+	under, over, both := "msub", "msup", "msubsup"
+	if large && p.display {
+		under, over, both = "munder", "mover", "munderover"
+	}
+	switch {
+	case sub != "" && sup != "":
+		return "<" + both + ">" + base + wrapRow(sub) + wrapRow(sup) + "</" + both + ">"
+	case sub != "":
+		return "<" + under + ">" + base + wrapRow(sub) + "</" + under + ">"
+	case sup != "":
+		return "<" + over + ">" + base + wrapRow(sup) + "</" + over + ">"
+	}
+	return base
+}
+
+// Parses a single argument: a {group}, a command or a single character.
+func (p *texParser) parseArgument() string {
+	p.skipSpaces()
+	if p.pos < len(p.src) && p.src[p.pos] != '{' && p.src[p.pos] != '\\' {
+		// Only a single character, so x^10 is x¹0 as in TeX.
+		c := p.src[p.pos]
+		p.pos++
+		return texChar(c)
+	}
+	atom, _ := p.parseAtom()
+	return atom
+}
+
+// Reads a raw {text} argument without interpreting its content.
+func (p *texParser) parseRawArgument() string {
+	p.skipSpaces()
+	if p.pos >= len(p.src) || p.src[p.pos] != '{' {
+		return ""
+	}
+	depth := 0
+	start := p.pos + 1
+	for ; p.pos < len(p.src); p.pos++ {
+		switch p.src[p.pos] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				p.pos++
+				return string(p.src[start : p.pos-1])
+			}
+		}
+	}
+	return string(p.src[start:])
+}
+
+func (p *texParser) parseGroup() string {
+	p.pos++ // {
+	row := p.parseRow(texStopGroup)
+	if p.pos < len(p.src) {
+		p.pos++ // }
+	}
+	return "<mrow>" + row + "</mrow>"
+}
+
+// Parses an atom, reporting whether it is a large operator which takes limits.
+func (p *texParser) parseAtom() (string, bool) {
+	p.skipSpaces()
+	if p.pos >= len(p.src) {
+		return "", false
+	}
+	c := p.src[p.pos]
+	switch {
+	case c == '{':
+		return p.parseGroup(), false
+	case c == '\\':
+		return p.parseCommand()
+	case unicode.IsDigit(c) || c == '.':
+		start := p.pos
+		for p.pos < len(p.src) && (unicode.IsDigit(p.src[p.pos]) || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		return "<mn>" + string(p.src[start:p.pos]) + "</mn>", false
+	}
+	p.pos++
+	return texChar(c), false
+}
+
+func texChar(c rune) string {
+	switch {
+	case unicode.IsLetter(c):
+		return "<mi>" + string(c) + "</mi>"
+	case unicode.IsDigit(c):
+		return "<mn>" + string(c) + "</mn>"
+	}
+	return "<mo>" + html.EscapeString(string(c)) + "</mo>"
+}
+
+func wrapRow(s string) string {
+	if strings.HasPrefix(s, "<mrow>") {
+		return s
+	}
+	return "<mrow>" + s + "</mrow>"
+}
+
+func (p *texParser) parseCommand() (string, bool) {
+	name := p.readCommand()
+
+	if v, ok := texIdentifiers[name]; ok {
+		if unicode.IsUpper([]rune(name)[0]) {
+			return `<mi mathvariant="normal">` + v + "</mi>", false
+		}
+		return "<mi>" + v + "</mi>", false
+	}
+	if v, ok := texOperators[name]; ok {
+		return "<mo>" + html.EscapeString(v) + "</mo>", false
+	}
+	if v, ok := texLargeOperators[name]; ok {
+		return "<mo largeop=\"true\">" + v + "</mo>", true
+	}
+	if v, ok := texSpaces[name]; ok {
+		return `<mspace width="` + v + `"></mspace>`, false
+	}
+	if StringInSlice(name, texFunctions) {
+		return "<mi>" + name + "</mi><mo>⁡</mo>", false
+	}
+	if StringInSlice(name, texLimits) {
+		return `<mo movablelimits="true">` + name + "</mo>", true
+	}
+	if v, ok := texAccents[name]; ok {
+		arg := p.parseArgument()
+		return "<mover accent=\"true\">" + wrapRow(arg) + "<mo stretchy=\"true\">" + v + "</mo></mover>", false
+	}
+	if v, ok := texFonts[name]; ok {
+		arg := p.parseArgument()
+		return `<mstyle mathvariant="` + v + `">` + arg + "</mstyle>", false
+	}
+
+	switch name {
+	case "frac", "dfrac", "tfrac":
+		num := p.parseArgument()
+		den := p.parseArgument()
+		return "<mfrac>" + wrapRow(num) + wrapRow(den) + "</mfrac>", false
+	case "binom":
+		n := p.parseArgument()
+		k := p.parseArgument()
+		return `<mrow><mo>(</mo><mfrac linethickness="0">` + wrapRow(n) + wrapRow(k) + "</mfrac><mo>)</mo></mrow>", false
+	case "sqrt":
+		p.skipSpaces()
+		if p.pos < len(p.src) && p.src[p.pos] == '[' {
+			end := p.pos
+			for end < len(p.src) && p.src[end] != ']' {
+				end++
+			}
+			index := (&texParser{src: p.src[p.pos+1 : end], display: p.display}).parseRow(0)
+			p.pos = end + 1
+			radicand := p.parseArgument()
+			return "<mroot>" + wrapRow(radicand) + wrapRow(index) + "</mroot>", false
+		}
+		return "<msqrt>" + p.parseArgument() + "</msqrt>", false
+	case "text", "textrm", "mbox":
+		return "<mtext>" + html.EscapeString(p.parseRawArgument()) + "</mtext>", false
+	case "left":
+		open := p.parseDelimiter()
+		row := p.parseRow(texStopRight)
+		closing := ""
+		if p.peekCommand() == "right" {
+			p.readCommand()
+			closing = p.parseDelimiter()
+		}
+		return "<mrow>" + open + row + closing + "</mrow>", false
+	case "begin":
+		return p.parseEnvironment(p.parseRawArgument()), false
+	}
+
+	return "<merror><mtext>\\" + html.EscapeString(name) + "</mtext></merror>", false
+}
+
+func (p *texParser) parseDelimiter() string {
+	p.skipSpaces()
+	if p.pos >= len(p.src) {
+		return ""
+	}
+	var d string
+	if p.src[p.pos] == '\\' {
+		name := p.readCommand()
+		d = texOperators[name]
+	} else {
+		d = string(p.src[p.pos])
+		p.pos++
+	}
+	if d == "." || d == "" {
+		return ""
+	}
+	return `<mo fence="true" stretchy="true">` + html.EscapeString(d) + "</mo>"
+}
+
+var texMatrixFences = map[string][2]string{
+	"pmatrix": {"(", ")"}, "bmatrix": {"[", "]"}, "Bmatrix": {"{", "}"},
+	"vmatrix": {"|", "|"}, "Vmatrix": {"‖", "‖"}, "cases": {"{", ""},
+}
+
+// Parses matrix-like environments (matrix, pmatrix, cases, aligned...) into a table.
+func (p *texParser) parseEnvironment(env string) string {
+	var rows []string
+	var cells []string
+	for {
+		cells = append(cells, "<mtd>"+p.parseRow(texStopCell)+"</mtd>")
+		if p.pos >= len(p.src) {
+			break
+		}
+		if p.src[p.pos] == '&' {
+			p.pos++
+			continue
+		}
+		cmd := p.readCommand()
+		rows = append(rows, "<mtr>"+strings.Join(cells, "")+"</mtr>")
+		cells = nil
+		if cmd == "end" {
+			p.parseRawArgument()
+			break
+		}
+	}
+	if len(cells) > 0 {
+		rows = append(rows, "<mtr>"+strings.Join(cells, "")+"</mtr>")
+	}
+
+	columnAlign := ""
+	if env == "cases" || strings.HasPrefix(env, "align") {
+		columnAlign = ` columnalign="left"`
+	}
+	table := "<mtable" + columnAlign + ">" + strings.Join(rows, "") + "</mtable>"
+	if fences, ok := texMatrixFences[env]; ok {
+		closing := ""
+		if fences[1] != "" {
+			closing = `<mo fence="true" stretchy="true">` + fences[1] + "</mo>"
+		}
+		return `<mrow><mo fence="true" stretchy="true">` + html.EscapeString(fences[0]) + "</mo>" + table + closing + "</mrow>"
+	}
+	return table
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yuin/goldmark"
+)
+
+func convertMath(t *testing.T, md string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := goldmark.New(goldmark.WithExtensions(Math)).Convert([]byte(md), &buf); err != nil {
+		t.Fatalf("converting %q: %v", md, err)
+	}
+	return buf.String()
+}
+
+func TestMathInline(t *testing.T) {
+	tests := []struct {
+		md   string
+		want string
+	}{
+		{"$x^2$", `<p><math xmlns="http://www.w3.org/1998/Math/MathML"><semantics><mrow><msup><mi>x</mi><mrow><mn>2</mn></mrow></msup></mrow><annotation encoding="application/x-tex">x^2</annotation></semantics></math></p>`},
+		{"$$a$$ inline", `<p><math xmlns="http://www.w3.org/1998/Math/MathML" display="block"><semantics><mrow><mi>a</mi></mrow><annotation encoding="application/x-tex">a</annotation></semantics></math> inline</p>`},
+		// Prices are not math
+		{"It costs $5 and $10.", "<p>It costs $5 and $10.</p>"},
+		{"$a $", "<p>$a $</p>"},
+		{"$ a$", "<p>$ a$</p>"},
+		{"$a", "<p>$a</p>"},
+	}
+	for _, tt := range tests {
+		if got := strings.TrimSpace(convertMath(t, tt.md)); got != tt.want {
+			t.Errorf("%q\n got %v\nwant %v", tt.md, got, tt.want)
+		}
+	}
+}
+
+func TestMathBlock(t *testing.T) {
+	block := `<div class="math"><math xmlns="http://www.w3.org/1998/Math/MathML" display="block"><semantics><mrow><mi>a</mi><mo>+</mo><mi>b</mi></mrow><annotation encoding="application/x-tex">a+b</annotation></semantics></math></div>`
+	tests := []struct {
+		md   string
+		want string
+	}{
+		{"$$\na+b\n$$\n", block},
+		{"$$ a+b $$\n", block},
+		{"Text\n$$\na+b\n$$\nMore", "<p>Text</p>\n" + block + "\n<p>More</p>"},
+		// An unclosed block runs to the end of the document, like a fenced
+		// code block
+		{"$$\na+b\n", block},
+		{"$$\na\n\n+b", `<div class="math"><math xmlns="http://www.w3.org/1998/Math/MathML" display="block"><semantics><mrow><mi>a</mi><mo>+</mo><mi>b</mi></mrow><annotation encoding="application/x-tex">a
+
++b</annotation></semantics></math></div>`},
+	}
+	for _, tt := range tests {
+		if got := strings.TrimSpace(convertMath(t, tt.md)); got != tt.want {
+			t.Errorf("%q\n got %v\nwant %v", tt.md, got, tt.want)
+		}
+	}
+}
+
+func TestTexToMathML(t *testing.T) {
+	tests := []struct {
+		tex  string
+		want string
+	}{
+		{`\frac{a}{b}`, "<mfrac><mrow><mi>a</mi></mrow><mrow><mi>b</mi></mrow></mfrac>"},
+		{"{{a}^{2}}_1", "<msub><mrow><msup><mrow><mi>a</mi></mrow><mrow><mn>2</mn></mrow></msup></mrow><mrow><mn>1</mn></mrow></msub>"},
+		{"x_{i_{j}}", "<msub><mi>x</mi><mrow><msub><mi>i</mi><mrow><mi>j</mi></mrow></msub></mrow></msub>"},
+		{"x^10", "<msup><mi>x</mi><mrow><mn>1</mn></mrow></msup><mn>0</mn>"},
+		{"3.14", "<mn>3.14</mn>"},
+		{"a<b", "<mi>a</mi><mo>&lt;</mo><mi>b</mi>"},
+		// Unbalanced groups are closed at the end
+		{"a+{b", "<mi>a</mi><mo>+</mo><mrow><mi>b</mi></mrow>"},
+		{`\nosuchcommand`, `<merror><mtext>\nosuchcommand</mtext></merror>`},
+	}
+	for _, tt := range tests {
+		got := TexToMathML(tt.tex, false)
+		body := strings.TrimSuffix(strings.TrimPrefix(got[strings.Index(got, "<semantics>"):], "<semantics><mrow>"), "</semantics></math>")
+		body = body[:strings.LastIndex(body, "</mrow><annotation")]
+		if body != tt.want {
+			t.Errorf("TexToMathML(%q) = %v, want %v", tt.tex, body, tt.want)
+		}
+	}
+}
+
+// A line full of unmatched $ is scanned once, not once for every $
+func TestMathInlineLongLine(t *testing.T) {
+	md := strings.Repeat("$a ", 20000)
+	start := time.Now()
+	got := convertMath(t, md)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("converting a %d byte line took %v", len(md), elapsed)
+	}
+	if strings.Contains(got, "<math") {
+		t.Errorf("got %.200v...", got)
+	}
+}
+
+func BenchmarkMathInlineLongLine(b *testing.B) {
+	md := []byte(strings.Repeat("$a ", 20000))
+	converter := goldmark.New(goldmark.WithExtensions(Math))
+	for i := 0; i < b.N; i++ {
+		var buf bytes.Buffer
+		if err := converter.Convert(md, &buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
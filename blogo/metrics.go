@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Set once the articles are loaded at startup, reported by /readyz
+var ready atomic.Bool
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blogo_http_requests_total",
+		Help: "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "blogo_http_request_duration_seconds",
+		Help:    "Time to serve an HTTP request, by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+	loadDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "blogo_load_articles_duration_seconds",
+		Help:    "Time to load all the articles.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+	})
+	renderDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "blogo_render_duration_seconds",
+		Help:    "Time to render the static page of an article.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 12),
+	})
+	watcherEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blogo_watcher_events_total",
+		Help: "File changes seen by the watcher, by kind of file.",
+	}, []string{"kind"})
+	nostrPublishes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "blogo_nostr_publish_total",
+		Help: "Articles published to Nostr, by relay and result.",
+	}, []string{"relay", "result"})
+)
+
+var metricsRegistry = prometheus.NewRegistry()
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, loadDuration, renderDuration, watcherEvents, nostrPublishes,
+		contentCollector{},
+	)
+}
+
+var (
+	articlesDesc = prometheus.NewDesc("blogo_articles", "Articles by state: published, draft or scheduled.", []string{"state"}, nil)
+	badgerKeys   = prometheus.NewDesc("blogo_badger_keys", "Keys in the Badger database.", nil, nil)
+	badgerSize   = prometheus.NewDesc("blogo_badger_size_bytes", "Estimated size of the data in the Badger database.", nil, nil)
+)
+
+// Reports the articles and the database size when the metrics are scraped
+type contentCollector struct{}
+
+func (contentCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- articlesDesc
+	ch <- badgerKeys
+	ch <- badgerSize
+}
+
+func (contentCollector) Collect(ch chan<- prometheus.Metric) {
+	counts := map[string]int{"published": 0, "draft": 0, "scheduled": 0}
+	now := time.Now()
+	for _, article := range Badger.GetArticleIndex() {
+		switch {
+		case article.Draft:
+			counts["draft"]++
+		case article.Date.After(now):
+			counts["scheduled"]++
+		default:
+			counts["published"]++
+		}
+	}
+	for state, count := range counts {
+		ch <- prometheus.MustNewConstMetric(articlesDesc, prometheus.GaugeValue, float64(count), state)
+	}
+
+	keys, size := Badger.Stats()
+	ch <- prometheus.MustNewConstMetric(badgerKeys, prometheus.GaugeValue, float64(keys))
+	ch <- prometheus.MustNewConstMetric(badgerSize, prometheus.GaugeValue, float64(size))
+}
+
+// Answers 503 until the articles are loaded, so no page is served, and
+// cached, without them
+func WhenReady(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ready.Load() {
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Counts the requests and their duration by route
+func Instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		// The pattern, not the path, so the number of series stays small
+		route := "none"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(sw.status)).Inc()
+		httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = code, true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+var metricsHandler = promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+
+// Serves the Prometheus metrics, if enabled in the config
+func GetMetrics(w http.ResponseWriter, r *http.Request) {
+	if !Site().Config.Metrics {
+		NotFound(w, r)
+		return
+	}
+	metricsHandler.ServeHTTP(w, r)
+}
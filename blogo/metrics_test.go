@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestGetReady(t *testing.T) {
+	t.Cleanup(func() { ready.Store(false) })
+	for _, tt := range []struct {
+		ready bool
+		code  int
+	}{{false, http.StatusServiceUnavailable}, {true, http.StatusOK}} {
+		ready.Store(tt.ready)
+		w := httptest.NewRecorder()
+		GetReady(w, httptest.NewRequest("GET", "/readyz", nil))
+		if w.Code != tt.code {
+			t.Errorf("GetReady with ready %v = %v, want %v", tt.ready, w.Code, tt.code)
+		}
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Instrument)
+	r.Get("/metrics-test/{slug}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	counter := httpRequests.WithLabelValues("/metrics-test/{slug}", "GET", "418")
+	before := testutil.ToFloat64(counter)
+	for _, slug := range []string{"a", "b"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics-test/"+slug, nil))
+	}
+	if got := testutil.ToFloat64(counter) - before; got != 2 {
+		t.Errorf("counted %v requests for the route, want 2", got)
+	}
+}
+
+func TestGetMetrics(t *testing.T) {
+	withBadger(t)
+	withConfig(t, func(c *Config) { c.Metrics = false })
+	w := httptest.NewRecorder()
+	GetMetrics(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GetMetrics when disabled = %v, want 404", w.Code)
+	}
+
+	withConfig(t, func(c *Config) { c.Metrics = true })
+	w = httptest.NewRecorder()
+	GetMetrics(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, name := range []string{"blogo_articles{state=\"published\"}", "blogo_badger_keys"} {
+		if !strings.Contains(w.Body.String(), name) {
+			t.Errorf("metrics without %v", name)
+		}
+	}
+}
+
+// Until the articles are loaded only the health routes answer
+func TestRoutesWaitUntilReady(t *testing.T) {
+	withBadger(t)
+	withContent(t, nil)
+	if err := InitTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ready.Store(false) })
+	r := InitRoutes()
+
+	tests := []struct {
+		path          string
+		loading, done int
+	}{
+		{"/healthz", http.StatusOK, http.StatusOK},
+		{"/readyz", http.StatusServiceUnavailable, http.StatusOK},
+		{"/", http.StatusServiceUnavailable, http.StatusOK},
+		{"/missing-page", http.StatusServiceUnavailable, http.StatusNotFound},
+		{"/nothing/here/at/all", http.StatusServiceUnavailable, http.StatusNotFound},
+	}
+	for _, isReady := range []bool{false, true} {
+		ready.Store(isReady)
+		for _, tt := range tests {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			want := tt.loading
+			if isReady {
+				want = tt.done
+			}
+			if w.Code != want {
+				t.Errorf("GET %v with ready %v = %v, want %v", tt.path, isReady, w.Code, want)
+			}
+		}
+	}
+}
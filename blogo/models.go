@@ -6,25 +6,108 @@ import (
 )
 
 type ArticleData struct {
-	Title    string
-	Author   string
-	Summary  string
-	Tags     []string
-	Image    string
-	Date     time.Time
-	Slug     string
-	Draft    bool
-	Layout   string
-	Md       string
-	Html     template.HTML
-	NostrUrl string
+	Title   string
+	Author  string
+	Summary string
+	Tags    []string
+	Image   string
+	Date    time.Time
+	Slug    string
+	// Old slugs or paths that redirect to the article
+	Aliases []string
+	Draft   bool
+	Layout  string
+	Link    string
+	Menu    string
+	Weight  int
+	Lang    string
+	// Articles with the same key are translations of each other
+	TranslationKey string
+	Md             string
+	Html           template.HTML
+	NostrUrl       string
+	// The hashes of the <style> elements of its Html, for the Content
+	// Security Policy
+	StyleHashes []string
 }
 
 type Config struct {
-	Title       string
+	Title       string `yaml:"title" toml:"title"`
+	Description string `yaml:"description" toml:"description"`
+	Url         string `yaml:"url" toml:"url"`
+	Keywords    string `yaml:"keywords" toml:"keywords"`
+	Analytics   string `yaml:"analytics" toml:"analytics"`
+	Timezone    string `yaml:"timezone" toml:"timezone"`
+	// The location of the timezone, set by Validate
+	Location    *time.Location          `yaml:"-" toml:"-"`
+	ContentPath string                  `yaml:"content_path" toml:"content_path"`
+	Port        int                     `yaml:"port" toml:"port"`
+	Dev         bool                    `yaml:"dev" toml:"dev"`
+	Metrics     bool                    `yaml:"metrics" toml:"metrics"`
+	Log         LogConfig               `yaml:"log" toml:"log"`
+	PageSize    int                     `yaml:"page_size" toml:"page_size"`
+	Permalink   string                  `yaml:"permalink" toml:"permalink"`
+	Theme       string                  `yaml:"theme" toml:"theme"`
+	Language    string                  `yaml:"language" toml:"language"`
+	Languages   []string                `yaml:"languages" toml:"languages"`
+	Layouts     map[string]LayoutConfig `yaml:"layouts" toml:"layouts"`
+	Menus       map[string][]MenuItem   `yaml:"menus" toml:"menus"`
+	TagAliases  map[string]string       `yaml:"tag_aliases" toml:"tag_aliases"`
+	Markdown    MarkdownConfig          `yaml:"markdown" toml:"markdown"`
+	Cache       CacheConfig             `yaml:"cache" toml:"cache"`
+	Security    SecurityConfig          `yaml:"security" toml:"security"`
+	Server      ServerConfig            `yaml:"server" toml:"server"`
+	Nostr       NostrConfig             `yaml:"nostr" toml:"nostr"`
+}
+
+// An entry of a navigation menu
+type MenuItem struct {
+	Title  string `yaml:"title" toml:"title"`
+	Url    string `yaml:"url" toml:"url"`
+	Weight int    `yaml:"weight" toml:"weight"`
+}
+
+// A tag with the number of listed articles that have it
+type Tag struct {
+	Slug        string
+	Name        string
 	Description string
-	Url         string
-	Keywords    string
-	Analytics   string
-	Timezone    string
+	Count       int
+}
+
+// The posts of a year in the archive
+type ArchiveYear struct {
+	Year   int
+	Count  int
+	Months []ArchiveMonth
+}
+
+// The posts of a month in the archive
+type ArchiveMonth struct {
+	Year     int
+	Month    time.Month
+	Articles []ArticleData
+}
+
+// How the articles of a layout are published
+type LayoutConfig struct {
+	// Shown in the index, the tag pages and the feeds
+	Listed bool `yaml:"listed" toml:"listed"`
+	// Served at /<slug> instead of /p/<slug>
+	Standalone bool `yaml:"standalone" toml:"standalone"`
+}
+
+// Timeouts of the HTTP server. Zero disables a timeout.
+type ServerConfig struct {
+	ReadTimeout  Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout  Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	// How long in-flight requests have to finish on shutdown
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+type NostrConfig struct {
+	Publish bool     `yaml:"publish" toml:"publish"`
+	Nsec    string   `yaml:"nsec" toml:"nsec"`
+	Relays  []string `yaml:"relays" toml:"relays"`
 }
@@ -1,37 +1,39 @@
 package main
 
 import (
-	"context"
 	"crypto/md5"
 	"fmt"
 	"os"
-	"path"
 	"strconv"
 	"strings"
 
 	"github.com/nbd-wtf/go-nostr"
 	"github.com/nbd-wtf/go-nostr/nip19"
-	"github.com/rs/zerolog/log"
 )
 
 var nostrSk string
 var nostrPk string
 var relayList []string
 
+var defaultRelays = []string{"wss://nostr-pub.wellorder.net", "wss://relay.damus.io", "wss://relay.nostr.band"}
+
 // Initializes the Nostr key set and relay list.
 func InitNostr() error {
-	nsec := os.Getenv("NOSTR_NSEC")
+	nsec := Site().Config.Nostr.Nsec
 	var npub string
 	var err error
 	if nsec == "" {
-		log.Warn().Msg("NOSTR_NSEC not set. Generating a new key pair.")
+		Log("nostr").Warn().Msg("NOSTR_NSEC not set. Generating a new key pair.")
 		nostrSk, nostrPk, nsec, npub, err = GetNewKeySet()
 		if err != nil {
 			return fmt.Errorf("failed to get public key: %w", err)
 		}
-		log.Info().Msgf("Generated new key set:\n\nnsec: %v\nnpub: %v\n\n", nsec, npub)
+		// The secret key is printed once, outside of the logs, which may be
+		// collected and kept elsewhere
+		fmt.Fprintf(os.Stderr, "\nGenerated Nostr secret key: %v\n\n", nsec)
+		Log("nostr").Info().Str("npub", npub).Msg("Generated a new key pair, set NOSTR_NSEC to the secret key printed above to keep it across restarts")
 	} else {
-		log.Info().Msg("NOSTR_NSEC set. Deriving existing key pair.")
+		Log("nostr").Info().Msg("NOSTR_NSEC set. Deriving existing key pair.")
 		_, value, err := nip19.Decode(nsec)
 		if err != nil {
 			return fmt.Errorf("failed to decode: %w", err)
@@ -53,32 +55,25 @@ func InitNostr() error {
 		}
 	}
 
-	envRelays := os.Getenv("NOSTR_RELAYS")
-	if envRelays == "" {
-		log.Warn().Msg("NOSTR_RELAYS not set. Using default relays.")
-		relayList = []string{"wss://nostr-pub.wellorder.net", "wss://relay.damus.io", "wss://relay.nostr.band"}
+	if relays := Site().Config.Nostr.Relays; len(relays) == 0 {
+		Log("nostr").Warn().Msg("No Nostr relays set. Using default relays.")
+		relayList = defaultRelays
 	} else {
-		relayList = strings.Split(envRelays, ",")
+		relayList = relays
 	}
 
-	fmt.Println("Public Key:", nostrPk)
-	fmt.Println("npub: ", npub)
+	Log("nostr").Info().Str("public_key", nostrPk).Str("npub", npub).Strs("relays", relayList).Msg("Nostr publishing enabled")
 	return nil
 }
 
 // Publishes the article to Nostr if enabled and not yet published
 func PublishArticleToNostr(article ArticleData) error {
-	if article.Slug == "about" {
-		log.Info().Msg("Not publishing about page to Nostr")
-		return nil
-	}
-
-	if os.Getenv("PUBLISH_TO_NOSTR") == "false" {
-		log.Info().Msg("PUBLISH_TO_NOSTR is set to false. Not publishing...")
+	if !Site().Config.Nostr.Publish {
+		Log("nostr").Info().Msg("Nostr publishing is disabled. Not publishing...")
 		return nil
 	}
 
-	log.Printf("NostrUrl value (%v) for %v", article.NostrUrl, article.Slug)
+	Log("nostr").Debug().Str("slug", article.Slug).Msgf("NostrUrl value (%v)", article.NostrUrl)
 	// We try to parse the NostrUrl field as a boolean.
 	// If it's empty or set to true, we publish.
 	// If it's set to false or anything that evaluates to false, we don't publish.
@@ -87,31 +82,31 @@ func PublishArticleToNostr(article ArticleData) error {
 		if article.NostrUrl == "" {
 			publishNostr = true
 		} else {
-			log.Info().Msgf("NostrUrl value (%v) is set, and not False. Not publishing...", article.NostrUrl)
+			Log("nostr").Info().Msgf("NostrUrl value (%v) is set, and not False. Not publishing...", article.NostrUrl)
 			return nil
 		}
 	}
 
 	// If the NostrUrl field is set to something that evaluates as false, we don't publish
 	if !publishNostr {
-		log.Info().Msgf("NostrUrl value (%v) is set to False. Not publishing...", article.NostrUrl)
+		Log("nostr").Info().Msgf("NostrUrl value (%v) is set to False. Not publishing...", article.NostrUrl)
 		return nil
 	}
 
 	// If the article is a draft we don't publish
 	if !article.Draft {
-		log.Info().Msgf("Publishing %v to Nostr", article.Slug)
+		Log("nostr").Info().Msgf("Publishing %v to Nostr", article.Slug)
 		naddr, err := NostrPublish(article)
 		if err != nil {
-			log.Err(err).Msg("Could not publish to Nostr")
+			Log("nostr").Err(err).Msg("Could not publish to Nostr")
 		} else {
 			err = AddMetadataToFile(fmt.Sprintf("%v.md", article.Slug), "NostrUrl", fmt.Sprintf("https://njump.me/%v", naddr))
 			if err != nil {
-				log.Err(err).Msgf("Could not add %v to NostrUrl field", naddr)
+				Log("nostr").Err(err).Msgf("Could not add %v to NostrUrl field", naddr)
 			}
 		}
 	} else {
-		log.Printf("Won't publisht this to Nostr: it's a draft")
+		Log("nostr").Info().Str("slug", article.Slug).Msg("Won't publish this to Nostr: it's a draft")
 	}
 	return nil
 }
@@ -125,7 +120,7 @@ func NostrPublish(ad ArticleData) (string, error) {
 	}
 
 	// Add the article original URL to the top of the article
-	ad.Md = fmt.Sprintf("> [Read the original blog post](%v)\n\n", path.Join(Blogo.Url, "/p/", ad.Slug)) + ad.Md
+	ad.Md = fmt.Sprintf("> [Read the original blog post](%v)\n\n", Permalink(ad)) + ad.Md
 
 	// md5 hash the title and slug to get a unique ID
 	id := fmt.Sprintf("%x", md5.Sum([]byte(ad.Title+ad.Author)))
@@ -138,7 +133,7 @@ func NostrPublish(ad ArticleData) (string, error) {
 	}
 
 	articleTags := nostr.Tags{}
-	for _, tag := range ad.Tags {
+	for _, tag := range ArticleTags(ad) {
 		articleTags = append(articleTags, nostr.Tag{"t", tag})
 	}
 	tags = append(tags, articleTags...)
@@ -151,20 +146,20 @@ func NostrPublish(ad ArticleData) (string, error) {
 		Content:   ad.Md,
 	}
 
-	log.Debug().Msgf("Nostr event: %v", ev)
+	Log("nostr").Debug().Msgf("Nostr event: %v", ev)
 
 	// Sign the event
 	err := ev.Sign(nostrSk)
 	if err != nil {
-		log.Err(err).Msg("Could not sign event")
+		Log("nostr").Err(err).Msg("Could not sign event")
 		return "", err
 	}
 
-	// Publish the event to the relays
-	ctx := context.Background()
+	// Publish the event to the relays, unless Blogo is shutting down
+	ctx := AppContext
 	connected := false
 	published := false
-	if os.Getenv("DEV") == "true" {
+	if Site().Config.Dev {
 		// In development mode, mock the Nostr publish
 		connected = true
 		published = true
@@ -172,17 +167,20 @@ func NostrPublish(ad ArticleData) (string, error) {
 		for _, url := range relayList {
 			relay, err := nostr.RelayConnect(ctx, url)
 			if err != nil {
-				log.Err(err).Msgf("failed to connect to relay %v:", url)
+				Log("nostr").Err(err).Msgf("failed to connect to relay %v:", url)
+				nostrPublishes.WithLabelValues(url, "failure").Inc()
 				continue
 			}
 			connected = true
 			if err := relay.Publish(ctx, ev); err != nil {
-				log.Warn().Err(err).Msgf("failed to publish to %v", url)
+				Log("nostr").Warn().Err(err).Msgf("failed to publish to %v", url)
+				nostrPublishes.WithLabelValues(url, "failure").Inc()
 				continue
 			}
+			nostrPublishes.WithLabelValues(url, "success").Inc()
 
 			published = true
-			fmt.Printf("published %v to %s\n", ev.ID, url)
+			Log("nostr").Info().Str("event", ev.ID).Str("relay", url).Msg("Published to Nostr")
 		}
 	}
 
@@ -194,7 +192,7 @@ func NostrPublish(ad ArticleData) (string, error) {
 	// Encode the note ID to naddr format
 	naddr, err := nip19.EncodeEntity(ev.PubKey, nostr.KindArticle, id, []string{})
 	if err != nil {
-		log.Err(err).Msg("Could not encode note ID")
+		Log("nostr").Err(err).Msg("Could not encode note ID")
 		return ev.ID, err
 	}
 	return naddr, nil
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Loads all pages from the pages folder. Every page is served at /<slug>.
+func LoadPages() error {
+	root := path.Join(Site().Config.ContentPath, "pages")
+	var slugs []string
+	err := filepath.Walk(root, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if fpath == root && os.IsNotExist(err) {
+				return nil
+			}
+			Log("content").Error().Err(err).Msgf("Could not access %v", fpath)
+			SetLoadError(fpath, err)
+			return nil
+		}
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".md") {
+			slugs = append(slugs, strings.TrimSuffix(info.Name(), ".md"))
+			ReloadPage(fpath)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if !StringInSlice("about", slugs) {
+		if _, err := os.Stat(LegacyAboutFile()); err == nil {
+			Log("content").Warn().Msg("Serving articles/about.md as the about page, move it to pages/about.md")
+			slugs = append(slugs, "about")
+			ReloadPage(LegacyAboutFile())
+		}
+	}
+
+	// Remove pages that are no longer in the pages folder
+	for _, page := range Badger.GetAllPages() {
+		if !StringInSlice(page.Slug, slugs) {
+			RemovePage(path.Join(root, page.Slug+".md"))
+		}
+	}
+	return nil
+}
+
+// The about page used to be articles/about.md. Until it is moved to
+// pages/about.md, it is still served at /about and kept out of the listings,
+// the feeds and Nostr.
+func LegacyAboutFile() string {
+	return path.Join(Site().Config.ContentPath, "articles", "about.md")
+}
+
+func isLegacyAbout(fpath string) bool {
+	return filepath.Clean(fpath) == LegacyAboutFile()
+}
+
+// Loads a page file and renders its static HTML, recording the outcome in
+// the load errors report.
+func ReloadPage(fpath string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while loading page: %v", r)
+		}
+		if err != nil {
+			Log("content").Error().Err(err).Str("file", fpath).Msg("Could not load page")
+			SetLoadError(fpath, err)
+		} else {
+			ClearLoadError(fpath)
+		}
+	}()
+
+	page, err := GetPageFromFile(fpath)
+	if err != nil {
+		return err
+	}
+
+	pageJson, err := json.Marshal(page)
+	if err != nil {
+		return fmt.Errorf("error while marshalling page to JSON: %v", err)
+	}
+	if err := Badger.Set("page_"+page.Slug, pageJson); err != nil {
+		return fmt.Errorf("error while storing page: %v", err)
+	}
+	BumpGeneration()
+
+	return GeneratePageStatic(page)
+}
+
+// Returns a page from a markdown file. Pages have no required metadata, the
+// title defaults to the slug.
+func GetPageFromFile(fpath string) (ArticleData, error) {
+	page, err := getMarkdownFile(fpath, true)
+	if err != nil {
+		return page, err
+	}
+	if page.Title == "" {
+		page.Title = strings.ReplaceAll(page.Slug, "-", " ")
+	}
+	if page.Layout == "" {
+		page.Layout = "page"
+	}
+	return page, nil
+}
+
+func RemovePage(fpath string) {
+	Log("content").Info().Str("file", fpath).Msg("Removing page")
+	slug, _ := ParseFilePath(fpath)
+	Badger.DeletePage(slug)
+	removeGenerated(path.Join(Site().Config.ContentPath, "content", "pages", slug+".html"))
+	ClearLoadError(fpath)
+	BumpGeneration()
+}
+
+// Returns the items of a menu from the config sorted by their weight. The
+// main menu also links to the pages, except the ones with `Menu: false`.
+func Menu(name string) []MenuItem {
+	menu := append([]MenuItem{}, Site().Config.Menus[name]...)
+
+	if name == "main" {
+		pages := Badger.GetAllPages()
+		sort.Slice(pages, func(i, j int) bool {
+			return pages[i].Title < pages[j].Title
+		})
+		for _, page := range pages {
+			if page.Menu == "false" || page.Draft {
+				continue
+			}
+			title := page.Menu
+			if title == "" {
+				title = page.Title
+			}
+			menu = append(menu, MenuItem{Title: title, Url: "/" + page.Slug, Weight: page.Weight})
+		}
+	}
+
+	sort.SliceStable(menu, func(i, j int) bool {
+		return menu[i].Weight < menu[j].Weight
+	})
+	return menu
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadPages(t *testing.T) {
+	withBadger(t)
+	dir := withContent(t, map[string]string{
+		"pages/contact-me.md": "Write to me",
+		"pages/projects.md":   "---\nTitle: Projects\nWeight: -1\n---\n",
+		"pages/imprint.md":    "---\nTitle: Imprint\nMenu: false\n---\n",
+		"pages/uses.md":       "---\nTitle: Uses\nMenu: Setup\n---\n",
+		// Served as the about page until it is moved to pages/
+		"articles/about.md": "---\nTitle: About\n---\n",
+	})
+	InitGoldmark()
+	if err := InitTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadPages(); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := Badger.GetPageBySlug("contact-me")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Title != "contact me" || page.Layout != "page" {
+		t.Errorf("got title %q and layout %q, want the slug and page", page.Title, page.Layout)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "content", "pages", "contact-me.html")); err != nil {
+		t.Errorf("the page was not rendered: %v", err)
+	}
+
+	want := []MenuItem{
+		{Title: "Projects", Url: "/projects", Weight: -1},
+		{Title: "About", Url: "/about"},
+		{Title: "Setup", Url: "/uses"},
+		{Title: "contact me", Url: "/contact-me"},
+	}
+	if got := Menu("main"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Menu(main) = %v, want %v", got, want)
+	}
+
+	// Removed pages are dropped on the next load
+	os.Remove(filepath.Join(dir, "pages", "uses.md"))
+	if err := LoadPages(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Badger.GetPageBySlug("uses"); err == nil {
+		t.Error("the removed page is still loaded")
+	}
+}
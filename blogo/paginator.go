@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Splits a listing in pages of page_size items. The first page is
+// served at the path of the listing and the others at <path>/page/<n>, so
+// every page has its own URL.
+type Paginator struct {
+	// One-based number of the current page
+	Page       int
+	TotalPages int
+	PageSize   int
+	// Number of items in all the pages
+	Total int
+	// Path of the first page, like / or /t/go
+	Path string
+}
+
+// Returns the paginator of a page of a listing, or false if the page does
+// not exist. An empty listing has a single, empty, page.
+func NewPaginator(total, page int, path string) (Paginator, bool) {
+	size := Site().Config.PageSize
+	p := Paginator{
+		Page:       page,
+		PageSize:   size,
+		Total:      total,
+		Path:       path,
+		TotalPages: int(math.Ceil(float64(total) / float64(size))),
+	}
+	if p.TotalPages == 0 {
+		p.TotalPages = 1
+	}
+	return p, page >= 1 && page <= p.TotalPages
+}
+
+// Returns the items of the current page
+func (p Paginator) Articles(articles []ArticleData) []ArticleData {
+	from := (p.Page - 1) * p.PageSize
+	to := from + p.PageSize
+	if from > len(articles) {
+		from = len(articles)
+	}
+	if to > len(articles) {
+		to = len(articles)
+	}
+	return articles[from:to]
+}
+
+func (p Paginator) HasPrev() bool {
+	return p.Page > 1
+}
+
+func (p Paginator) HasNext() bool {
+	return p.Page < p.TotalPages
+}
+
+func (p Paginator) PrevURL() string {
+	return p.URL(p.Page - 1)
+}
+
+func (p Paginator) NextURL() string {
+	return p.URL(p.Page + 1)
+}
+
+// Returns the URL of a page
+func (p Paginator) URL(page int) string {
+	if page <= 1 {
+		return p.Path
+	}
+	return fmt.Sprintf("%v/page/%d", strings.TrimSuffix(p.Path, "/"), page)
+}
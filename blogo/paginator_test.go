@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestNewPaginator(t *testing.T) {
+	withConfig(t, func(c *Config) { c.PageSize = 10 })
+	tests := []struct {
+		total, page int
+		pages       int
+		ok          bool
+	}{
+		{0, 1, 1, true},
+		{0, 2, 1, false},
+		{10, 1, 1, true},
+		{11, 2, 2, true},
+		{11, 3, 2, false},
+		{25, 0, 3, false},
+	}
+	for _, tt := range tests {
+		p, ok := NewPaginator(tt.total, tt.page, "/")
+		if p.TotalPages != tt.pages || ok != tt.ok {
+			t.Errorf("NewPaginator(%v, %v) = %v pages, %v, want %v pages, %v", tt.total, tt.page, p.TotalPages, ok, tt.pages, tt.ok)
+		}
+	}
+}
+
+func TestPaginatorArticles(t *testing.T) {
+	withConfig(t, func(c *Config) { c.PageSize = 2 })
+	articles := []ArticleData{{Slug: "a"}, {Slug: "b"}, {Slug: "c"}}
+	tests := map[int][]ArticleData{
+		1: {{Slug: "a"}, {Slug: "b"}},
+		2: {{Slug: "c"}},
+		3: {},
+	}
+	for page, want := range tests {
+		p, _ := NewPaginator(len(articles), page, "/")
+		if got := p.Articles(articles); !reflect.DeepEqual(got, want) {
+			t.Errorf("page %v has %v, want %v", page, got, want)
+		}
+	}
+}
+
+func TestPaginatorURLs(t *testing.T) {
+	withConfig(t, func(c *Config) { c.PageSize = 10 })
+	tests := []struct {
+		path             string
+		page             int
+		prev, next       string
+		hasPrev, hasNext bool
+	}{
+		{"/", 1, "/", "/page/2", false, true},
+		{"/", 2, "/", "/page/3", true, true},
+		{"/t/go", 3, "/t/go/page/2", "/t/go/page/4", true, false},
+		{"/t/go/", 2, "/t/go/", "/t/go/page/3", true, true},
+	}
+	for _, tt := range tests {
+		p, _ := NewPaginator(30, tt.page, tt.path)
+		if p.PrevURL() != tt.prev || p.NextURL() != tt.next || p.HasPrev() != tt.hasPrev || p.HasNext() != tt.hasNext {
+			t.Errorf("page %v of %v: prev %v %v, next %v %v", tt.page, tt.path, p.HasPrev(), p.PrevURL(), p.HasNext(), p.NextURL())
+		}
+	}
+}
+
+func TestListingsSkipDrafts(t *testing.T) {
+	withContent(t, nil)
+	withBadger(t)
+	withConfig(t, func(c *Config) { c.PageSize = 2 })
+	if err := InitTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	lang := Site().Config.Language
+	articles := []ArticleData{
+		{Slug: "draft-1", Title: "Draft 1", Tags: []string{"secret"}, Draft: true, Date: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{Slug: "draft-2", Title: "Draft 2", Tags: []string{"secret"}, Draft: true, Date: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{Slug: "post-1", Title: "Post 1", Tags: []string{"go"}, Date: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{Slug: "post-2", Title: "Post 2", Tags: []string{"go"}, Date: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{Slug: "post-3", Title: "Post 3", Tags: []string{"go"}, Date: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, article := range articles {
+		article.Lang = lang
+		if err := Badger.SetArticle(article); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { Badger.DeleteArticle(article.Slug) })
+	}
+
+	get := func(handler http.HandlerFunc, target string, params map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		rctx := chi.NewRouteContext()
+		for key, value := range params {
+			rctx.URLParams.Add(key, value)
+		}
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	// The drafts do not take the place of the posts on the first page
+	w := get(GetIndex, "/", nil)
+	if body := w.Body.String(); w.Code != http.StatusOK || !strings.Contains(body, "Post 1") || !strings.Contains(body, "Post 2") || strings.Contains(body, "Draft") {
+		t.Errorf("the first page is %v without posts 1 and 2, or with a draft", w.Code)
+	}
+	if w := get(GetIndex, "/page/2", map[string]string{"page": "2"}); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Post 3") {
+		t.Errorf("the second page is %v without post 3", w.Code)
+	}
+	if w := get(GetIndex, "/page/3", map[string]string{"page": "3"}); w.Code != http.StatusNotFound {
+		t.Errorf("a page of drafts is %v, want 404", w.Code)
+	}
+
+	// A tag used only by drafts does not exist
+	if w := get(GetTagPosts, "/t/secret", map[string]string{"tag": "secret"}); w.Code != http.StatusNotFound {
+		t.Errorf("the tag of the drafts is %v, want 404", w.Code)
+	}
+	for _, tag := range AllTags(lang) {
+		if tag.Slug == "secret" {
+			t.Error("AllTags lists the tag of the drafts")
+		}
+	}
+}
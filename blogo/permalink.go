@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The URL of the posts before the permalink pattern was configurable. It
+// keeps working, and redirects to the permalink of the post.
+const LegacyPermalink = "/p/{slug}"
+
+// The placeholders of a permalink pattern, and the route segments they match.
+// The dates only match digits, so they never hide the language prefixes.
+var permalinkParams = map[string]string{
+	"{year}":  "{year:[0-9]{4}}",
+	"{month}": "{month:[0-9]{2}}",
+	"{day}":   "{day:[0-9]{2}}",
+	"{slug}":  "{slug}",
+}
+
+var permalinkPlaceholder = regexp.MustCompile(`\{[^}]*\}`)
+
+// The first path segments of the built-in routes, which a permalink can not
+// start with. The languages of the site are reserved too.
+var reservedSegments = []string{"p", "t", "tags", "archive", "page", "static", "rss", "atom", "json", "healthz", "readyz", "metrics"}
+
+// Checks a permalink pattern, like /{year}/{month}/{slug}/
+func validatePermalink(pattern string, languages []string) error {
+	if !strings.HasPrefix(pattern, "/") {
+		return fmt.Errorf("permalink must start with /, got %q", pattern)
+	}
+	if strings.Count(pattern, "{slug}") != 1 {
+		return fmt.Errorf("permalink must have one {slug}, got %q", pattern)
+	}
+	for _, placeholder := range permalinkPlaceholder.FindAllString(pattern, -1) {
+		if _, ok := permalinkParams[placeholder]; !ok {
+			return fmt.Errorf("unknown %v in permalink %q, use {year}, {month}, {day} and {slug}", placeholder, pattern)
+		}
+	}
+	// The pages are at /<slug>
+	if strings.HasPrefix(pattern, "/{slug}") {
+		return fmt.Errorf("permalink can not start with {slug}, it is where the pages are")
+	}
+	// Only the legacy URL of the posts starts with /p/
+	first, _, _ := strings.Cut(strings.TrimPrefix(pattern, "/"), "/")
+	if StringInSlice(first, languages) || (StringInSlice(first, reservedSegments) && strings.TrimSuffix(pattern, "/") != LegacyPermalink) {
+		return fmt.Errorf("permalink %q clashes with the built-in /%v routes, start it with another segment", pattern, first)
+	}
+	return nil
+}
+
+// Returns the URL path of a post from the permalink pattern of the site,
+// with the date of the post in the timezone of the site
+func expandPermalink(pattern string, article ArticleData) string {
+	date := article.Date.In(Site().Config.Location)
+	return strings.NewReplacer(
+		"{year}", fmt.Sprintf("%04d", date.Year()),
+		"{month}", fmt.Sprintf("%02d", int(date.Month())),
+		"{day}", fmt.Sprintf("%02d", date.Day()),
+		"{slug}", article.Slug,
+	).Replace(pattern)
+}
+
+// Returns the absolute URL of an article
+func Permalink(article ArticleData) string {
+	return Site().Config.Url + ArticlePath(article)
+}
+
+// The routes that serve the posts: the permalink pattern with and without
+// its trailing slash, and the legacy URL
+func PermalinkRoutes(pattern string) []string {
+	route := permalinkPlaceholder.ReplaceAllStringFunc(pattern, func(placeholder string) string {
+		return permalinkParams[placeholder]
+	})
+
+	var routes []string
+	for _, r := range []string{route, strings.TrimSuffix(route, "/"), route + "/", LegacyPermalink} {
+		if r != "" && !strings.HasSuffix(r, "//") && !StringInSlice(r, routes) {
+			routes = append(routes, r)
+		}
+	}
+	return routes
+}
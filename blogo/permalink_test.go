@@ -0,0 +1,115 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestValidatePermalink(t *testing.T) {
+	languages := []string{"en", "es"}
+	tests := []struct {
+		pattern string
+		valid   bool
+	}{
+		{LegacyPermalink, true},
+		{"/p/{slug}/", true},
+		{"/{year}/{month}/{slug}/", true},
+		{"/{year}/{month}/{day}/{slug}", true},
+		{"/posts/{slug}", true},
+		{"/blog/{year}/{slug}", true},
+		{"/posts/{slug}/", true},
+
+		{"posts/{slug}", false},
+		{"/posts", false},
+		{"/posts/{slug}/{slug}", false},
+		{"/posts/{title}", false},
+		{"/{slug}", false},
+		{"/{slug}/{year}", false},
+
+		// The built-in routes
+		{"/p/{year}/{slug}", false},
+		{"/t/{slug}", false},
+		{"/tags/{slug}", false},
+		{"/archive/{slug}", false},
+		{"/page/{slug}", false},
+		{"/static/{slug}", false},
+		{"/rss/{slug}", false},
+		{"/healthz/{slug}", false},
+		{"/readyz/{slug}", false},
+		{"/metrics/{slug}", false},
+		{"/es/{slug}", false},
+		{"/en/{year}/{slug}", false},
+	}
+	for _, tt := range tests {
+		err := validatePermalink(tt.pattern, languages)
+		if (err == nil) != tt.valid {
+			t.Errorf("validatePermalink(%q) = %v, want valid %v", tt.pattern, err, tt.valid)
+		}
+	}
+}
+
+func TestExpandPermalink(t *testing.T) {
+	withTimezone(t, "UTC")
+	article := ArticleData{Slug: "hello-world", Date: time.Date(2024, 3, 7, 10, 0, 0, 0, time.UTC)}
+	tests := map[string]string{
+		LegacyPermalink:                     "/p/hello-world",
+		"/{year}/{month}/{slug}/":           "/2024/03/hello-world/",
+		"/{year}/{month}/{day}/{slug}":      "/2024/03/07/hello-world",
+		"/posts/{slug}":                     "/posts/hello-world",
+		"/{year}/{slug}-{month}{day}/":      "/2024/hello-world-0307/",
+		"/blog/{year}/{month}/{day}/{slug}": "/blog/2024/03/07/hello-world",
+	}
+	for pattern, want := range tests {
+		if got := expandPermalink(pattern, article); got != want {
+			t.Errorf("expandPermalink(%q) = %v, want %v", pattern, got, want)
+		}
+	}
+}
+
+func TestPermalinkRoutes(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{LegacyPermalink, []string{"/p/{slug}", "/p/{slug}/"}},
+		{"/p/{slug}/", []string{"/p/{slug}/", "/p/{slug}"}},
+		{"/posts/{slug}", []string{"/posts/{slug}", "/posts/{slug}/", "/p/{slug}"}},
+		{"/{year}/{month}/{slug}/", []string{
+			"/{year:[0-9]{4}}/{month:[0-9]{2}}/{slug}/",
+			"/{year:[0-9]{4}}/{month:[0-9]{2}}/{slug}",
+			"/p/{slug}",
+		}},
+	}
+	for _, tt := range tests {
+		if got := PermalinkRoutes(tt.pattern); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("PermalinkRoutes(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestAliasesFollowThePermalink(t *testing.T) {
+	withTimezone(t, "UTC")
+	withConfig(t, func(c *Config) { c.Permalink = "/{year}/{slug}/" })
+	withBadger(t)
+	article := ArticleData{Slug: "new-post", Aliases: []string{"old-post"}, Date: time.Date(2024, 3, 7, 10, 0, 0, 0, time.UTC)}
+	if err := Badger.SetArticle(article); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Badger.DeleteArticle(article.Slug) })
+
+	for _, path := range []string{"/2024/old-post/", "/p/old-post"} {
+		if got, _ := FindRedirect(path); got != "/2024/new-post/" {
+			t.Errorf("FindRedirect(%v) = %q, want /2024/new-post/", path, got)
+		}
+	}
+}
+
+func TestExpandPermalinkInSiteTimezone(t *testing.T) {
+	// Already March 8th there, whatever the timezone of the machine
+	withTimezone(t, "Pacific/Kiritimati")
+	article := ArticleData{Slug: "hello-world", Date: time.Date(2024, 3, 7, 12, 0, 0, 0, time.UTC)}
+	if got := expandPermalink("/{year}/{month}/{day}/{slug}", article); got != "/2024/03/08/hello-world" {
+		t.Errorf("expandPermalink = %v, want the date in the timezone of the site", got)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The file with the redirects, in the content folder
+func RedirectsFile() string {
+	return path.Join(Site().Config.ContentPath, "redirects.yaml")
+}
+
+// Loads the redirects of redirects.yaml, a map of old paths to new paths or
+// URLs. A file that can not be parsed keeps the previous redirects.
+func LoadRedirects() error {
+	file := RedirectsFile()
+	content, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		UpdateSite(func(s *siteState) { s.Redirects = map[string]string{} })
+		ClearLoadError(file)
+		return nil
+	}
+
+	redirects := map[string]string{}
+	if err == nil {
+		err = yaml.Unmarshal(content, &redirects)
+	}
+	for from, to := range redirects {
+		if strings.TrimSpace(to) == "" {
+			err = fmt.Errorf("redirect of %v has no target", from)
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("error parsing %v: %v", file, err)
+		SetLoadError(file, err)
+		return err
+	}
+	ClearLoadError(file)
+
+	normalized := make(map[string]string, len(redirects))
+	for from, to := range redirects {
+		normalized[redirectPath(from)] = to
+	}
+	UpdateSite(func(s *siteState) { s.Redirects = normalized })
+	Log("content").Info().Msgf("Loaded %v redirects", len(normalized))
+	return nil
+}
+
+// Paths are matched with and without their trailing slash
+func redirectPath(p string) string {
+	return "/" + strings.Trim(p, "/")
+}
+
+// The paths an alias of an article redirects from. An alias is an old slug
+// of the article, at its permalink and its legacy URL, or a path starting
+// with a slash.
+func aliasPaths(article ArticleData, alias string) []string {
+	if strings.HasPrefix(alias, "/") {
+		return []string{redirectPath(alias)}
+	}
+	article.Slug = alias
+	return []string{redirectPath(ArticlePath(article)), redirectPath(expandPermalink(LegacyPermalink, article))}
+}
+
+// Returns where an old path moved to, from redirects.yaml or the aliases of
+// the articles
+func FindRedirect(p string) (string, bool) {
+	p = redirectPath(p)
+	if target, ok := Site().Redirects[p]; ok {
+		return target, true
+	}
+	for _, article := range Badger.GetArticleIndex() {
+		for _, alias := range article.Aliases {
+			if alias != article.Slug && StringInSlice(p, aliasPaths(article, alias)) {
+				return ArticlePath(article), true
+			}
+		}
+	}
+	return "", false
+}
+
+// Redirects the request to the new location of its path, if it has moved
+func redirectMoved(w http.ResponseWriter, r *http.Request) bool {
+	target, ok := FindRedirect(r.URL.Path)
+	if !ok {
+		return false
+	}
+	if r.URL.RawQuery != "" && !strings.Contains(target, "?") {
+		target += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
+	return true
+}
+
+// How long after a rename a new file with the same content is taken as the
+// renamed article
+const renameWindow = 5 * time.Second
+
+// The articles renamed recently, by the hash of their content, to find the
+// file they were renamed to
+var renamedArticles = struct {
+	sync.Mutex
+	slugs map[[32]byte]renamedArticle
+}{slugs: map[[32]byte]renamedArticle{}}
+
+type renamedArticle struct {
+	slug string
+	time time.Time
+}
+
+// Remembers the slug and content of an article file that is being renamed
+func RememberRename(fpath string) {
+	slug, _ := ParseFilePath(fpath)
+	article, err := Badger.GetPostBySlug(slug)
+	if err != nil {
+		return
+	}
+
+	renamedArticles.Lock()
+	defer renamedArticles.Unlock()
+	for hash, renamed := range renamedArticles.slugs {
+		if time.Since(renamed.time) > renameWindow {
+			delete(renamedArticles.slugs, hash)
+		}
+	}
+	renamedArticles.slugs[sha256.Sum256([]byte(article.Md))] = renamedArticle{slug, time.Now()}
+}
+
+// Returns the old slug of a new article file with the same content as an
+// article renamed just before
+func RenamedFrom(fpath string) (string, bool) {
+	content, err := os.ReadFile(fpath)
+	if err != nil {
+		return "", false
+	}
+	hash := sha256.Sum256(content)
+
+	renamedArticles.Lock()
+	defer renamedArticles.Unlock()
+	renamed, ok := renamedArticles.slugs[hash]
+	if !ok || time.Since(renamed.time) > renameWindow {
+		return "", false
+	}
+	delete(renamedArticles.slugs, hash)
+	slug, _ := ParseFilePath(fpath)
+	return renamed.slug, renamed.slug != slug
+}
+
+// Adds an old slug to the Aliases of an article file, keeping the rest of its
+// front matter as it is
+func AddAliasToFile(fpath, alias string) error {
+	content, err := os.ReadFile(fpath)
+	if err != nil {
+		return err
+	}
+	block, ok := splitFrontMatter(content)
+	if !ok {
+		return fmt.Errorf("could not find the front matter of %v", fpath)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(block, &doc); err != nil || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("invalid front matter in %v", fpath)
+	}
+	mapping := doc.Content[0]
+	var aliases *yaml.Node
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == "Aliases" {
+			aliases = mapping.Content[i+1]
+		}
+	}
+	if aliases == nil {
+		aliases = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "Aliases"}, aliases)
+	} else if aliases.Kind != yaml.SequenceNode {
+		// An empty Aliases key
+		*aliases = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	}
+	for _, node := range aliases.Content {
+		if node.Value == alias {
+			return nil
+		}
+	}
+	aliases.Content = append(aliases.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: alias})
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return err
+	}
+	encoder.Close()
+
+	// The body starts after the closing --- of the front matter
+	start := bytes.Index(content, block) + len(block)
+	rest := content[start:]
+	if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+		rest = rest[i+1:]
+	} else {
+		rest = nil
+	}
+
+	var out bytes.Buffer
+	out.WriteString("---\n")
+	out.Write(buf.Bytes())
+	out.WriteString("---\n")
+	out.Write(rest)
+	return os.WriteFile(fpath, out.Bytes(), 0644)
+}
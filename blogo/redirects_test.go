@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindRedirect(t *testing.T) {
+	dir := t.TempDir()
+	withConfig(t, func(c *Config) { c.ContentPath = dir })
+	withBadger(t)
+	previous := Site()
+	t.Cleanup(func() { site.Store(previous) })
+
+	os.WriteFile(RedirectsFile(), []byte("/old-page/: /about\n/gone: https://example.com\n"), 0644)
+	if err := LoadRedirects(); err != nil {
+		t.Fatal(err)
+	}
+	article := ArticleData{Slug: "new-post", Aliases: []string{"old-post", "/2019/old-post"}}
+	if err := Badger.SetArticle(article); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Badger.DeleteArticle(article.Slug) })
+
+	tests := map[string]string{
+		"/old-page":       "/about",
+		"/gone/":          "https://example.com",
+		"/p/old-post":     ArticlePath(article),
+		"/2019/old-post/": ArticlePath(article),
+		"/p/new-post":     "",
+	}
+	for path, want := range tests {
+		if got, _ := FindRedirect(path); got != want {
+			t.Errorf("FindRedirect(%v) = %q, want %q", path, got, want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	NotFound(w, httptest.NewRequest("GET", "/old-page?ref=feed", nil))
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/about?ref=feed" {
+		t.Errorf("NotFound of a moved page = %v to %q", w.Code, w.Header().Get("Location"))
+	}
+
+	// A broken file keeps the previous redirects
+	os.WriteFile(RedirectsFile(), []byte("/old-page: \"\"\n"), 0644)
+	if err := LoadRedirects(); err == nil {
+		t.Error("LoadRedirects accepted a redirect without target")
+	}
+	ClearLoadError(RedirectsFile())
+	if _, ok := FindRedirect("/old-page"); !ok {
+		t.Error("a broken redirects.yaml dropped the previous redirects")
+	}
+}
+
+func TestAddAliasToFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "new-post.md")
+	os.WriteFile(file, []byte("---\nTitle: New post\nDate: 2024-03-07\nDraft: false\n---\nBody\n"), 0644)
+
+	for i := 0; i < 2; i++ {
+		if err := AddAliasToFile(file, "old-post"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	content, _ := os.ReadFile(file)
+	if strings.Count(string(content), "old-post") != 1 || !strings.HasSuffix(string(content), "---\nBody\n") {
+		t.Errorf("AddAliasToFile wrote:\n%s", content)
+	}
+	if _, errs := ParseFrontMatter(file, content, false); len(errs) > 0 {
+		t.Errorf("the front matter is no longer valid: %v", errs)
+	}
+}
@@ -2,72 +2,89 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"math"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/dustin/go-humanize"
-	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/cors"
-	"github.com/rs/zerolog/log"
+	"github.com/go-chi/chi/v5/middleware"
 	"gorm.io/datatypes"
 )
 
-var IndexTmpl *template.Template
-var TagTmpl *template.Template
-var PostTmpl *template.Template
-var AboutTmpl *template.Template
-
 func InitRoutes() *chi.Mux {
 	// Router
 	r := chi.NewRouter()
-	r.Use(middleware.Logger)
-
-	if os.Getenv("DEV") == "true" {
-		// Parse templates on every request
-		r.Use(func(next http.Handler) http.Handler {
-			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				InitTemplates()
-				next.ServeHTTP(w, r)
-			})
-		})
-	}
+	r.Use(Instrument)
+	r.Use(middleware.RequestID)
+	r.Use(AccessLog)
+	r.Use(Compress)
+	r.Use(SecurityHeaders)
+
+	// Answered while the articles are loading
+	r.Get("/healthz", GetHealth)
+	r.Get("/readyz", GetReady)
+	r.Get("/metrics", GetMetrics)
+
+	r.Group(func(r chi.Router) {
+		r.Use(WhenReady)
+
+		r.Handle("/static/chroma.css", http.StripPrefix("/static/", CachedStatic(http.HandlerFunc(HandleChromaCss))))
+		r.Handle("/static/*", http.StripPrefix("/static/", CachedStatic(http.HandlerFunc(ServeStatic))))
 
-	// Setup CORS
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins: []string{"*"},
-		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
-		AllowedMethods:   []string{"GET"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: false,
-		MaxAge:           300, // Maximum value not ignored by any of major browsers
-	}))
-
-	fileServer := http.FileServer(http.Dir(fmt.Sprintf("%v/static", os.Getenv("CONTENT_PATH"))))
-	r.Handle("/static/*", http.StripPrefix("/static/", fileServer))
-
-	r.Get("/", GetIndex)
-	r.Get("/p/{slug}", ServeBlogPost)
-	r.Get("/p/{slug}/raw", GetRawMarkdown)
-	r.Get("/t/{tag}", GetTagPosts)
-	r.Get("/about", GetAbout)
-
-	r.Get("/rss", HandleRssFeed)
-	r.Get("/atom", HandleAtomFeed)
-	r.Get("/json", HandleJsonFeed)
+		// Posts, at their permalink and the legacy /p/<slug>
+		for _, route := range PermalinkRoutes(Site().Config.Permalink) {
+			r.Get(route, Cached(CacheArticles, ServeBlogPost))
+		}
+		r.Get("/p/{slug}/raw", Shared(Cached(CacheArticles, GetRawMarkdown)))
+
+		listingRoutes(r)
+
+		// The other languages of the site, like /es/
+		r.Route("/{lang}", listingRoutes)
+
+		// Matched last, after all the other routes
+		r.Get("/{slug}", Cached(CacheArticles, ServePage))
+	})
+	r.NotFound(WhenReady(http.HandlerFunc(NotFound)).ServeHTTP)
 
 	return r
 }
 
-func createTemplate(files []string) *template.Template {
-	funcMap := template.FuncMap{
+// The routes that exist for every language of the site
+func listingRoutes(r chi.Router) {
+	// Rendered once for every version of the content
+	listing := func(h http.HandlerFunc) http.HandlerFunc {
+		return Cached(CacheListings, RenderCached(h))
+	}
+	// Other sites may read the feeds
+	feed := func(h http.HandlerFunc) http.HandlerFunc {
+		return Shared(Cached(CacheFeeds, RenderCached(h)))
+	}
+
+	r.Get("/", listing(GetIndex))
+	r.Get("/page/{page}", listing(GetIndex))
+	r.Get("/t/{tag}", listing(GetTagPosts))
+	r.Get("/t/{tag}/page/{page}", listing(GetTagPosts))
+	r.Get("/tags", listing(GetTags))
+	r.Get("/archive", listing(GetArchive))
+	r.Get("/archive/{year}", listing(GetArchive))
+	r.Get("/archive/{year}/{month}", listing(GetArchive))
+
+	r.Get("/rss", feed(HandleRssFeed))
+	r.Get("/atom", feed(HandleAtomFeed))
+	r.Get("/json", feed(HandleJsonFeed))
+}
+
+// Functions available to all templates, including shortcodes
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
 		"toLower": strings.ToLower,
 		"truncate": func(s string) string {
 			if len(s) > 250 {
@@ -89,19 +106,24 @@ func createTemplate(files []string) *template.Template {
 		"getObject": func(d datatypes.JSON) []string {
 			var obj []string
 			if err := json.Unmarshal(d, &obj); err != nil {
-				log.Error().Err(err).Msg("Error unmarshalling JSON:")
+				Log("render").Error().Err(err).Msg("Error unmarshalling JSON:")
 			}
 			return obj
 		},
 		"baseUrl": func(u string) string {
 			parsedUrl, err := url.Parse(u)
 			if err != nil {
-				fmt.Println(err)
+				Log("render").Error().Err(err).Msgf("Invalid URL %q", u)
+				return ""
 			}
 
 			return (parsedUrl.Scheme + "://" + parsedUrl.Host)
 		},
-		"humanizeTime": func(t time.Time) string {
+		// Localized when a language is given
+		"humanizeTime": func(t time.Time, lang ...string) string {
+			if len(lang) > 0 {
+				return TimeAgo(t, lang[0])
+			}
 			return humanize.Time(t)
 		},
 		"readTime": func(s string) int {
@@ -114,36 +136,100 @@ func createTemplate(files []string) *template.Template {
 			readTime := math.Ceil(float64(wordCount) / float64(readSpeed))
 			return int(readTime)
 		},
-		"dateString": func(t time.Time) string {
+		"articlePath": ArticlePath,
+		"permalink":   Permalink,
+		"menu":        Menu,
+		"dateString": func(t time.Time, lang ...string) string {
+			if len(lang) > 0 {
+				return FormatDate(t, lang[0])
+			}
 			return t.Format("2006-01-02")
 		},
+		"t":            Translate,
+		"langPath":     LangPath,
+		"languages":    func() []string { return Site().Config.AllLanguages() },
+		"translations": ArticleTranslations,
+		"tagSlug":      TagSlug,
+		"monthName":    MonthName,
+		"static":       StaticURL,
+		"tagSize": func(count int, tags []Tag) int {
+			// From 1 to 5, relative to the most used tag
+			if len(tags) == 0 || tags[0].Count == 0 {
+				return 1
+			}
+			return 1 + 4*count/tags[0].Count
+		},
 	}
+}
 
-	tmpl := template.New("").Funcs(funcMap)
+func createTemplate(theme fs.FS, files []string) (*template.Template, error) {
+	tmpl := template.New("").Funcs(templateFuncs())
 
-	_, err := tmpl.ParseFiles(files...)
+	_, err := tmpl.ParseFS(theme, files...)
 	if err != nil {
-		log.Error().Err(err).Msg("Error parsing template:")
+		return nil, err
 	}
 
-	return tmpl
+	return tmpl, nil
 }
 
-func InitTemplates() {
-	IndexTmpl = createTemplate([]string{
-		fmt.Sprintf("%v/templates/base.html", os.Getenv("CONTENT_PATH")),
-		fmt.Sprintf("%v/templates/index.html", os.Getenv("CONTENT_PATH")),
-	})
-	TagTmpl = createTemplate([]string{
-		fmt.Sprintf("%v/templates/base.html", os.Getenv("CONTENT_PATH")),
-		fmt.Sprintf("%v/templates/tag.html", os.Getenv("CONTENT_PATH")),
-	})
-	PostTmpl = createTemplate([]string{
-		fmt.Sprintf("%v/templates/base.html", os.Getenv("CONTENT_PATH")),
-		fmt.Sprintf("%v/templates/post.html", os.Getenv("CONTENT_PATH")),
-	})
-	AboutTmpl = createTemplate([]string{
-		fmt.Sprintf("%v/templates/base.html", os.Getenv("CONTENT_PATH")),
-		fmt.Sprintf("%v/templates/about.html", os.Getenv("CONTENT_PATH")),
+// Parses all the templates of the theme and swaps them in only if every one
+// of them is valid, so a typo while editing a template never breaks the
+// running site.
+func InitTemplates() error {
+	theme, err := LoadTheme(Site().Config.Theme)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	parse := func(name string) *template.Template {
+		tmpl, err := createTemplate(theme, []string{"templates/base.html", "templates/" + name})
+		if err != nil {
+			errs = append(errs, err)
+		}
+		return tmpl
+	}
+
+	index := parse("index.html")
+	tag := parse("tag.html")
+	tags := parse("tags.html")
+	archive := parse("archive.html")
+	notFound := parse("404.html")
+	serverError := parse("500.html")
+	post := parse("post.html")
+
+	// Alternative post templates, selected with the Layout field
+	layouts := map[string]*template.Template{}
+	files, _ := fs.Glob(theme, "templates/layouts/*.html")
+	for _, file := range files {
+		name, _ := ParseFilePath(file)
+		layouts[name] = parse("layouts/" + name + ".html")
+	}
+
+	shortcodes, err := createShortcodeTemplate(theme)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	i18n, err := loadI18n(theme)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("error parsing templates: %v", errors.Join(errs...))
+	}
+
+	UpdateSite(func(s *siteState) {
+		s.Theme = theme
+		s.Templates = Templates{
+			Index: index, Tag: tag, Tags: tags, Archive: archive, Post: post,
+			NotFound: notFound, Error: serverError,
+			Layouts:    layouts,
+			Shortcodes: shortcodes,
+		}
+		s.I18n = i18n
 	})
+	ResetFingerprints()
+	BumpGeneration()
+	return nil
 }
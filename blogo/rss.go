@@ -2,78 +2,108 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
-	"sort"
 	"time"
 
 	"github.com/gorilla/feeds"
-	"github.com/rs/zerolog/log"
 )
 
+// Updates the feeds of all the languages of the site
 func UpdateFeed() error {
+	var errs []error
+	for _, lang := range Site().Config.AllLanguages() {
+		if err := updateFeed(lang); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// The feed stored in Badger. The items of gorilla/feeds have no tags, so
+// the tag slugs of each item are kept next to the feed by item link.
+type SiteFeed struct {
+	feeds.Feed
+	Tags map[string][]string
+}
+
+func updateFeed(lang string) error {
+	cfg := Site().Config
 	now := time.Now()
-	feed := &feeds.Feed{
-		Title:       os.Getenv("BLOGO_TITLE"),
-		Link:        &feeds.Link{Href: fmt.Sprintf("%v/rss", os.Getenv("BLOGO_URL"))},
-		Description: os.Getenv("BLOGO_DESCRIPTION"),
-		Author:      &feeds.Author{Name: os.Getenv("BLOGO_TITLE")},
-		Created:     now,
+	feed := &SiteFeed{
+		Feed: feeds.Feed{
+			Title:       cfg.Title,
+			Link:        &feeds.Link{Href: fmt.Sprintf("%v%v/rss", cfg.Url, LangPath(lang))},
+			Description: cfg.Description,
+			Author:      &feeds.Author{Name: cfg.Title},
+			Created:     now,
+		},
+		Tags: map[string][]string{},
 	}
 
-	articles := Badger.GetAllArticles()
-	// Sort by date
-	sort.Slice(articles, func(i, j int) bool {
-		return articles[i].Date.After(articles[j].Date)
-	})
+	articles := ListedArticles(lang)
 
 	feed.Items = []*feeds.Item{}
 	for _, article := range articles {
-		if !article.Draft {
-			item := &feeds.Item{
-				Title:       article.Title,
-				Link:        &feeds.Link{Href: fmt.Sprintf("%v/p/%v", os.Getenv("BLOGO_URL"), article.Slug)},
-				Description: article.Summary,
-				Created:     article.Date,
-			}
-
-			feed.Items = append(feed.Items, item)
+		item := &feeds.Item{
+			Title:       article.Title,
+			Link:        &feeds.Link{Href: fmt.Sprintf("%v%v", cfg.Url, ArticlePath(article))},
+			Description: article.Summary,
+			Created:     article.Date,
 		}
+
+		feed.Items = append(feed.Items, item)
+		feed.Tags[item.Link.Href] = ArticleTags(article)
 	}
 
 	// Save feed to badger
 	json, err := json.Marshal(feed)
 	if err != nil {
-		log.Err(err).Msg("Error marshalling feed to JSON")
+		Log("content").Err(err).Msg("Error marshalling feed to JSON")
 		return err
 	}
-	Badger.Set("feed", json)
+	Badger.Set(feedKey(lang), json)
+	BumpGeneration()
 	return err
 }
 
-func GetFeed() feeds.Feed {
-	result, err := Badger.Get("feed")
+func feedKey(lang string) string {
+	if lang == Site().Config.Language {
+		return "feed"
+	}
+	return "feed_" + lang
+}
+
+func GetFeed(lang string) SiteFeed {
+	result, err := Badger.Get(feedKey(lang))
 	if err != nil {
-		log.Err(err).Msg("Error getting feed from Badger")
-		return feeds.Feed{}
+		Log("render").Err(err).Msg("Error getting feed from Badger")
+		return SiteFeed{}
 	}
 
 	// Unmarshal the result into an Article struct
-	var feed feeds.Feed
+	var feed SiteFeed
 	err = json.Unmarshal(result, &feed)
 	if err != nil {
-		log.Err(err).Msg("Error unmarshalling feed from Badger")
-		return feeds.Feed{}
+		Log("render").Err(err).Msg("Error unmarshalling feed from Badger")
+		return SiteFeed{}
 	}
 	return feed
 }
 
-func RssFeed() string {
-	feed := GetFeed()
+// RSS items only have room for one category, the first tag of the article
+func RssFeed(lang string) string {
+	feed := GetFeed(lang)
 
-	rss, err := feed.ToRss()
+	rssFeed := (&feeds.Rss{Feed: &feed.Feed}).RssFeed()
+	for _, item := range rssFeed.Items {
+		if tags := feed.Tags[item.Link]; len(tags) > 0 {
+			item.Category = tags[0]
+		}
+	}
+	rss, err := feeds.ToXML(rssFeed)
 	if err != nil {
-		log.Err(err).Msg("Error generating RSS feed")
+		Log("render").Err(err).Msg("Error generating RSS feed")
 		return ""
 	}
 
@@ -81,12 +111,12 @@ func RssFeed() string {
 	return rss
 }
 
-func AtomFeed() string {
-	feed := GetFeed()
+func AtomFeed(lang string) string {
+	feed := GetFeed(lang)
 
 	atom, err := feed.ToAtom()
 	if err != nil {
-		log.Err(err).Msg("Error generating Atom feed")
+		Log("render").Err(err).Msg("Error generating Atom feed")
 		return ""
 	}
 
@@ -94,12 +124,16 @@ func AtomFeed() string {
 	return atom
 }
 
-func JsonFeed() string {
-	feed := GetFeed()
+func JsonFeed(lang string) string {
+	feed := GetFeed(lang)
 
-	json, err := feed.ToJSON()
+	jsonFeed := (&feeds.JSON{Feed: &feed.Feed}).JSONFeed()
+	for _, item := range jsonFeed.Items {
+		item.Tags = feed.Tags[item.Url]
+	}
+	json, err := jsonFeed.ToJSON()
 	if err != nil {
-		log.Err(err).Msg("Error generating JSON feed")
+		Log("render").Err(err).Msg("Error generating JSON feed")
 		return ""
 	}
 
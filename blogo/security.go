@@ -0,0 +1,221 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/cors"
+)
+
+// Security headers sent with every response, read from the `security`
+// section of the config file. An empty value sends no header.
+type SecurityConfig struct {
+	// The sources and hashes needed by the analytics snippet and the inline
+	// styles of the articles are added to it
+	ContentSecurityPolicy string `yaml:"content_security_policy" toml:"content_security_policy"`
+	// Only sent when the url of the site is https
+	StrictTransportSecurity string `yaml:"strict_transport_security" toml:"strict_transport_security"`
+	ReferrerPolicy          string `yaml:"referrer_policy" toml:"referrer_policy"`
+	PermissionsPolicy       string `yaml:"permissions_policy" toml:"permissions_policy"`
+	// Origins allowed to fetch the feeds and the raw markdown of the posts
+	CorsOrigins []string `yaml:"cors_origins" toml:"cors_origins"`
+}
+
+// Everything comes from the site itself, except images, which posts often
+// link from other sites
+func DefaultSecurityConfig() SecurityConfig {
+	return SecurityConfig{
+		ContentSecurityPolicy:   "default-src 'self'; img-src 'self' data: https:; object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'self'",
+		StrictTransportSecurity: "max-age=31536000",
+		ReferrerPolicy:          "strict-origin-when-cross-origin",
+		PermissionsPolicy:       "camera=(), microphone=(), geolocation=(), payment=(), usb=()",
+		CorsOrigins:             []string{"*"},
+	}
+}
+
+// Adds the security headers to every response
+func SecurityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		site := Site().Config
+		cfg := site.Security
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		if policy := ContentSecurityPolicy(); policy != "" {
+			h.Set("Content-Security-Policy", policy)
+		}
+		if cfg.StrictTransportSecurity != "" && strings.HasPrefix(site.Url, "https://") && !site.Dev {
+			h.Set("Strict-Transport-Security", cfg.StrictTransportSecurity)
+		}
+		if cfg.ReferrerPolicy != "" {
+			h.Set("Referrer-Policy", cfg.ReferrerPolicy)
+		}
+		if cfg.PermissionsPolicy != "" {
+			h.Set("Permissions-Policy", cfg.PermissionsPolicy)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+var inlineTagRegex = regexp.MustCompile(`(?is)<(script|style)\b([^>]*)>(.*?)</(?:script|style)\s*>`)
+var scriptSrcRegex = regexp.MustCompile(`(?i)\bsrc\s*=\s*["']?([^"'\s>]+)`)
+
+// Returns the hashes of the <style> elements of a rendered article, like the
+// ones of the diagrams, to allow them in the Content Security Policy
+func StyleHashes(html string) []string {
+	var hashes []string
+	for _, m := range inlineTagRegex.FindAllStringSubmatch(html, -1) {
+		if hash := cspHash(m[3]); strings.EqualFold(m[1], "style") && !StringInSlice(hash, hashes) {
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes
+}
+
+func cspHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+}
+
+// The policy of the whole site is built again only when the config changes
+var cspCache = struct {
+	sync.Mutex
+	generation uint64
+	policy     string
+	built      bool
+}{}
+
+// Returns the Content-Security-Policy header: the one of the config, allowing
+// the scripts and styles of the analytics snippet, and the inline styles of
+// the article or page being served, given by their hashes
+func ContentSecurityPolicy(styles ...string) string {
+	policy := siteContentSecurityPolicy()
+	if policy == "" || len(styles) == 0 {
+		return policy
+	}
+	styles = append([]string{}, styles...)
+	sort.Strings(styles)
+	return extendPolicy(policy, map[string][]string{"style-src": styles})
+}
+
+// Sets the Content-Security-Policy of a response for the inline styles of
+// the article or page it serves, so every page only allows its own
+func allowStyles(w http.ResponseWriter, hashes []string) {
+	if len(hashes) == 0 {
+		return
+	}
+	if policy := ContentSecurityPolicy(hashes...); policy != "" {
+		w.Header().Set("Content-Security-Policy", policy)
+	}
+}
+
+// The policy of the config with the sources of the analytics snippet
+func siteContentSecurityPolicy() string {
+	gen := generation.Load()
+	cspCache.Lock()
+	defer cspCache.Unlock()
+	if cspCache.built && cspCache.generation == gen {
+		return cspCache.policy
+	}
+
+	cfg := Site().Config
+	var scripts, styles, connect []string
+	for _, m := range inlineTagRegex.FindAllStringSubmatch(cfg.Analytics, -1) {
+		isScript := strings.EqualFold(m[1], "script")
+		if src := scriptSrcRegex.FindStringSubmatch(m[2]); isScript && src != nil {
+			// Analytics scripts send their data back to where they come from
+			if u, err := url.Parse(src[1]); err == nil && u.Host != "" {
+				origin := u.Scheme + "://" + u.Host
+				scripts = append(scripts, origin)
+				connect = append(connect, origin)
+			}
+		} else if isScript && strings.TrimSpace(m[3]) != "" {
+			scripts = append(scripts, cspHash(m[3]))
+		} else if !isScript {
+			styles = append(styles, cspHash(m[3]))
+		}
+	}
+	sort.Strings(styles)
+
+	policy := cfg.Security.ContentSecurityPolicy
+	if policy != "" {
+		policy = extendPolicy(policy, map[string][]string{
+			"script-src":  scripts,
+			"style-src":   styles,
+			"connect-src": connect,
+		})
+	}
+	cspCache.generation, cspCache.policy, cspCache.built = gen, policy, true
+	return policy
+}
+
+// Adds sources to the directives of a policy. A missing directive starts
+// from default-src, which it replaces.
+func extendPolicy(policy string, sources map[string][]string) string {
+	var directives []string
+	values := map[string]string{}
+	for _, directive := range strings.Split(policy, ";") {
+		directive = strings.TrimSpace(directive)
+		if directive == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(directive, " ")
+		name = strings.ToLower(name)
+		directives = append(directives, name)
+		values[name] = strings.TrimSpace(value)
+	}
+
+	for _, name := range []string{"script-src", "style-src", "connect-src"} {
+		extra := sources[name]
+		if len(extra) == 0 {
+			continue
+		}
+		if _, ok := values[name]; !ok {
+			// Nothing is blocked without a default-src
+			if _, ok := values["default-src"]; !ok {
+				continue
+			}
+			directives = append(directives, name)
+			values[name] = values["default-src"]
+		}
+		if values[name] == "'none'" {
+			values[name] = ""
+		}
+		for _, source := range extra {
+			if !StringInSlice(source, strings.Fields(values[name])) {
+				values[name] = strings.TrimSpace(values[name] + " " + source)
+			}
+		}
+	}
+
+	parts := make([]string, len(directives))
+	for i, name := range directives {
+		parts[i] = strings.TrimSpace(name + " " + values[name])
+	}
+	return strings.Join(parts, "; ")
+}
+
+// CORS for the routes other sites may fetch, like the feeds. The allowed
+// origins are read on every request, so they follow the config.
+var sharedCors = cors.New(cors.Options{
+	AllowOriginFunc: func(r *http.Request, origin string) bool {
+		for _, allowed := range Site().Config.Security.CorsOrigins {
+			if allowed == "*" || strings.EqualFold(allowed, origin) {
+				return true
+			}
+		}
+		return false
+	},
+	AllowedMethods: []string{http.MethodGet, http.MethodHead},
+	MaxAge:         300, // Maximum value not ignored by any of major browsers
+})
+
+// Allows the other origins of the config to fetch a route
+func Shared(next http.HandlerFunc) http.HandlerFunc {
+	return sharedCors.Handler(next).ServeHTTP
+}
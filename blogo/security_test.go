@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestExtendPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		sources map[string][]string
+		want    string
+	}{
+		{
+			"nothing to add",
+			"default-src 'self'",
+			nil,
+			"default-src 'self'",
+		},
+		{
+			"existing directive",
+			"default-src 'self'; style-src 'self'",
+			map[string][]string{"style-src": {"'sha256-a'"}},
+			"default-src 'self'; style-src 'self' 'sha256-a'",
+		},
+		{
+			"from default-src",
+			"default-src 'self'; img-src https:",
+			map[string][]string{"script-src": {"https://stats.example.com"}, "connect-src": {"https://stats.example.com"}},
+			"default-src 'self'; img-src https:; script-src 'self' https://stats.example.com; connect-src 'self' https://stats.example.com",
+		},
+		{
+			"none",
+			"default-src 'none'; style-src 'none'",
+			map[string][]string{"style-src": {"'sha256-a'"}},
+			"default-src 'none'; style-src 'sha256-a'",
+		},
+		{
+			"no default-src",
+			"frame-ancestors 'self'",
+			map[string][]string{"style-src": {"'sha256-a'"}},
+			"frame-ancestors 'self'",
+		},
+		{
+			"no duplicates",
+			"STYLE-SRC 'self' 'sha256-a'",
+			map[string][]string{"style-src": {"'sha256-a'", "'sha256-b'"}},
+			"style-src 'self' 'sha256-a' 'sha256-b'",
+		},
+	}
+	for _, tt := range tests {
+		if got := extendPolicy(tt.policy, tt.sources); got != tt.want {
+			t.Errorf("%v: extendPolicy = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStyleHashes(t *testing.T) {
+	html := `<p>text</p><style>a{color:red}</style><svg><style>a{color:red}</style></svg><script>x()</script><STYLE>b{}</STYLE>`
+	want := []string{cspHash("a{color:red}"), cspHash("b{}")}
+	got := StyleHashes(html)
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("StyleHashes = %v, want %v", got, want)
+	}
+	if got := StyleHashes("<p>no styles</p>"); len(got) != 0 {
+		t.Errorf("StyleHashes without styles = %v", got)
+	}
+}
+
+func TestContentSecurityPolicyPerArticle(t *testing.T) {
+	withContent(t, map[string]string{
+		"content/post-a.html": "<p>a</p>",
+		"content/post-b.html": "<p>b</p>",
+	})
+	withBadger(t)
+	withConfig(t, func(c *Config) {
+		c.Analytics = ""
+		c.Security = DefaultSecurityConfig()
+	})
+	hashes := map[string]string{"post-a": cspHash(".a{}"), "post-b": cspHash(".b{}")}
+	for slug, hash := range hashes {
+		article := ArticleData{Slug: slug, Title: slug, StyleHashes: []string{hash}}
+		if err := Badger.SetArticle(article); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { Badger.DeleteArticle(slug) })
+	}
+
+	router := chi.NewRouter()
+	router.Use(SecurityHeaders)
+	router.Get("/p/{slug}", ServeBlogPost)
+	router.Get("/tags", func(w http.ResponseWriter, r *http.Request) {})
+	policy := func(path string) string {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Header().Get("Content-Security-Policy")
+	}
+
+	a, b := policy("/p/post-a"), policy("/p/post-b")
+	if !strings.Contains(a, "style-src 'self' "+hashes["post-a"]) || strings.Contains(a, hashes["post-b"]) {
+		t.Errorf("the policy of post-a is %q, want only its own style", a)
+	}
+	if !strings.Contains(b, hashes["post-b"]) || strings.Contains(b, hashes["post-a"]) {
+		t.Errorf("the policy of post-b is %q, want only its own style", b)
+	}
+	if other := policy("/tags"); strings.Contains(other, hashes["post-a"]) || strings.Contains(other, hashes["post-b"]) {
+		t.Errorf("the policy of another page allows the styles of the posts: %q", other)
+	}
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// Shortcode is the data passed to a shortcode template. Shortcodes are written
+// in Markdown as {{< name arg key="value" >}}, optionally wrapping content
+// that is closed with {{< /name >}}.
+type Shortcode struct {
+	Name   string
+	Args   []string
+	Params map[string]string
+	Inner  template.HTML
+	Blogo  Config
+	// Extra data prepared by built-in shortcodes
+	Data map[string]interface{}
+}
+
+// Returns the named parameter, or the positional argument at index pos.
+func (s Shortcode) Get(key string, pos int) string {
+	if value, ok := s.Params[key]; ok {
+		return value
+	}
+	if pos >= 0 && pos < len(s.Args) {
+		return s.Args[pos]
+	}
+	return ""
+}
+
+// Default templates for the built-in shortcodes. They can be overridden by
+// placing a file with the same name in templates/shortcodes/.
+var builtinShortcodes = map[string]string{
+	"youtube":  `<figure class="embed embed-video"><a href="{{.Data.Url}}" rel="noopener noreferrer" target="_blank"><img src="{{.Data.Thumbnail}}" alt="{{.Data.Title}}" loading="lazy"></a><figcaption>▶ <a href="{{.Data.Url}}" rel="noopener noreferrer" target="_blank">{{.Data.Title}}</a> (YouTube)</figcaption></figure>`,
+	"peertube": `<figure class="embed embed-video"><a href="{{.Data.Url}}" rel="noopener noreferrer" target="_blank">{{if .Data.Thumbnail}}<img src="{{.Data.Thumbnail}}" alt="{{.Data.Title}}" loading="lazy">{{end}}</a><figcaption>▶ <a href="{{.Data.Url}}" rel="noopener noreferrer" target="_blank">{{.Data.Title}}</a> (PeerTube)</figcaption></figure>`,
+	"figure":   `<figure><img src="{{.Get "src" 0}}" alt="{{or (.Get "alt" -1) (.Get "caption" 1)}}" loading="lazy">{{with .Get "caption" 1}}<figcaption>{{.}}</figcaption>{{end}}</figure>`,
+	"nostr":    `<blockquote class="embed embed-nostr">{{if .Data.Content}}<p>{{.Data.Content}}</p><footer>— <a href="{{.Data.Url}}" rel="noopener noreferrer" target="_blank">{{.Data.Author}}</a>{{if .Data.Date}}, {{dateString .Data.Date}}{{end}}</footer>{{else}}<p><a href="{{.Data.Url}}" rel="noopener noreferrer" target="_blank">View note on Nostr</a></p>{{end}}</blockquote>`,
+	"gist":     `<figure class="gist">{{.Data.Code}}<figcaption>{{.Data.File}}</figcaption></figure>`,
+}
+
+// Built-in shortcodes that need to prepare data before rendering
+var shortcodeHandlers = map[string]func(*Shortcode) error{
+	"youtube":  youtubeShortcode,
+	"peertube": peertubeShortcode,
+	"nostr":    nostrShortcode,
+	"gist":     gistShortcode,
+}
+
+func createShortcodeTemplate(theme fs.FS) (*template.Template, error) {
+	tmpl := template.New("").Funcs(templateFuncs())
+	for name, content := range builtinShortcodes {
+		template.Must(tmpl.New(name).Parse(content))
+	}
+
+	// User defined shortcodes, which can also override the built-in ones
+	files, _ := fs.Glob(theme, "templates/shortcodes/*.html")
+	for _, file := range files {
+		name, _ := ParseFilePath(file)
+		content, err := fs.ReadFile(theme, file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading shortcode template %v: %v", file, err)
+		}
+		if _, err := tmpl.New(name).Parse(string(content)); err != nil {
+			return nil, err
+		}
+	}
+	return tmpl, nil
+}
+
+var shortcodeRegex = regexp.MustCompile(`\{\{<(/\*)?\s*(/?)([\w-]+)((?:[^>"]|"[^"]*")*?)\s*(\*/)?>\}\}`)
+var shortcodeArgRegex = regexp.MustCompile(`([\w-]+)=(?:"([^"]*)"|(\S+))|"([^"]*)"|(\S+)`)
+var codeFenceRegex = regexp.MustCompile("(?ms)^[ \t]*(```|~~~).*?^[ \t]*(```|~~~)[ \t]*$")
+
+// Replaces the shortcodes in a markdown document with placeholders. The
+// rendered HTML for each placeholder is returned so it can be substituted
+// once the markdown has been converted, as goldmark would otherwise escape it.
+func ExpandShortcodes(md []byte) ([]byte, map[string]string) {
+	rendered := map[string]string{}
+	fences := codeFenceRegex.FindAllIndex(md, -1)
+	inFence := func(pos int) bool {
+		for _, f := range fences {
+			if pos >= f[0] && pos < f[1] {
+				return true
+			}
+		}
+		return false
+	}
+
+	var out bytes.Buffer
+	last := 0
+	matches := shortcodeRegex.FindAllSubmatchIndex(md, -1)
+	for i := 0; i < len(matches); i++ {
+		m := matches[i]
+		if m[0] < last || inFence(m[0]) {
+			continue
+		}
+		out.Write(md[last:m[0]])
+		last = m[1]
+
+		// {{</* name */>}} is an escaped shortcode, written out literally.
+		if m[2] != -1 && m[10] != -1 {
+			out.WriteString("{{<" + string(md[m[2]+2:m[10]]) + ">}}")
+			continue
+		}
+		if m[4] != m[5] {
+			// Stray closing tag
+			continue
+		}
+
+		sc := Shortcode{
+			Name:   string(md[m[6]:m[7]]),
+			Params: map[string]string{},
+			Blogo:  Site().Config,
+			Data:   map[string]interface{}{},
+		}
+		for _, arg := range shortcodeArgRegex.FindAllStringSubmatch(string(md[m[8]:m[9]]), -1) {
+			switch {
+			case arg[1] != "":
+				sc.Params[arg[1]] = arg[2] + arg[3]
+			case arg[4] != "":
+				sc.Args = append(sc.Args, arg[4])
+			default:
+				sc.Args = append(sc.Args, arg[5])
+			}
+		}
+
+		// Look for the matching closing tag
+		for j := i + 1; j < len(matches); j++ {
+			c := matches[j]
+			if c[4] != c[5] && string(md[c[6]:c[7]]) == sc.Name {
+				inner, _ := ConvertMarkdown(md[m[1]:c[0]])
+				sc.Inner = template.HTML(inner)
+				last = c[1]
+				break
+			}
+		}
+
+		placeholder := fmt.Sprintf("BLOGOSHORTCODE%dEND", len(rendered))
+		rendered[placeholder] = sc.Render()
+		out.WriteString(placeholder)
+	}
+	out.Write(md[last:])
+	return out.Bytes(), rendered
+}
+
+// Substitutes the placeholders left by ExpandShortcodes in the rendered HTML.
+func ReplaceShortcodePlaceholders(html []byte, rendered map[string]string) []byte {
+	for placeholder, content := range rendered {
+		html = bytes.ReplaceAll(html, []byte("<p>"+placeholder+"</p>"), []byte(content))
+		html = bytes.ReplaceAll(html, []byte(placeholder), []byte(content))
+	}
+	return html
+}
+
+func (sc Shortcode) Render() string {
+	tmpl := Site().Templates.Shortcodes
+	if tmpl == nil || tmpl.Lookup(sc.Name) == nil {
+		Log("render").Warn().Msgf("Unknown shortcode: %v", sc.Name)
+		return ""
+	}
+	if handler, ok := shortcodeHandlers[sc.Name]; ok {
+		if err := handler(&sc); err != nil {
+			Log("render").Warn().Err(err).Msgf("Error preparing shortcode %v", sc.Name)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, sc.Name, sc); err != nil {
+		Log("render").Error().Err(err).Msgf("Error executing shortcode %v", sc.Name)
+		return ""
+	}
+	return buf.String()
+}
+
+func youtubeShortcode(sc *Shortcode) error {
+	id := sc.Get("id", 0)
+	sc.Data["Url"] = fmt.Sprintf("https://www.youtube.com/watch?v=%v", url.QueryEscape(id))
+	sc.Data["Title"] = sc.Get("title", 1)
+	if sc.Data["Title"] == "" {
+		sc.Data["Title"] = "Watch on YouTube"
+	}
+
+	remote := fmt.Sprintf("https://i.ytimg.com/vi/%v/hqdefault.jpg", url.PathEscape(id))
+	sc.Data["Thumbnail"] = remote
+	thumbnail, err := cacheThumbnail(remote, "youtube-"+id+".jpg")
+	if err != nil {
+		return err
+	}
+	sc.Data["Thumbnail"] = thumbnail
+	return nil
+}
+
+func peertubeShortcode(sc *Shortcode) error {
+	instance := strings.TrimSuffix(sc.Get("instance", 0), "/")
+	if !strings.HasPrefix(instance, "http") {
+		instance = "https://" + instance
+	}
+	id := sc.Get("id", 1)
+	sc.Data["Url"] = fmt.Sprintf("%v/w/%v", instance, url.PathEscape(id))
+	sc.Data["Title"] = sc.Get("title", 2)
+	if sc.Data["Title"] == "" {
+		sc.Data["Title"] = "Watch on PeerTube"
+	}
+
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("%v/api/v1/videos/%v", instance, url.PathEscape(id)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var video struct {
+		Name          string `json:"name"`
+		ThumbnailPath string `json:"thumbnailPath"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&video); err != nil {
+		return fmt.Errorf("error decoding PeerTube video: %v", err)
+	}
+	if sc.Get("title", 2) == "" && video.Name != "" {
+		sc.Data["Title"] = video.Name
+	}
+	if video.ThumbnailPath != "" {
+		thumbnail, err := cacheThumbnail(instance+video.ThumbnailPath, "peertube-"+id+path.Ext(video.ThumbnailPath))
+		if err != nil {
+			return err
+		}
+		sc.Data["Thumbnail"] = thumbnail
+	}
+	return nil
+}
+
+// Downloads a remote thumbnail once into static/thumbnails, so visitors never
+// hit the video platform unless they follow the link.
+func cacheThumbnail(remote, name string) (string, error) {
+	name = filepath.Base(filepath.Clean("/" + name))
+	dir := path.Join(Site().Config.ContentPath, "static", "thumbnails")
+	local := fmt.Sprintf("/static/thumbnails/%v", name)
+	if _, err := os.Stat(path.Join(dir, name)); err == nil {
+		return local, nil
+	}
+
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(remote)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error downloading thumbnail %v: %v", remote, resp.Status)
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+	file, err := os.Create(path.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		return "", err
+	}
+	return local, nil
+}
+
+func nostrShortcode(sc *Shortcode) error {
+	ref := strings.TrimPrefix(sc.Get("id", 0), "nostr:")
+	sc.Data["Url"] = fmt.Sprintf("https://njump.me/%v", ref)
+
+	prefix, value, err := nip19.Decode(ref)
+	if err != nil {
+		return err
+	}
+	var id string
+	relays := relayList
+	switch prefix {
+	case "note":
+		id = value.(string)
+	case "nevent":
+		pointer := value.(nostr.EventPointer)
+		id = pointer.ID
+		relays = append(pointer.Relays, relays...)
+	default:
+		return fmt.Errorf("unsupported nostr reference %v", prefix)
+	}
+
+	event, err := GetNostrEvent(id, relays)
+	if err != nil {
+		return err
+	}
+	npub, _ := nip19.EncodePublicKey(event.PubKey)
+	if len(npub) > 16 {
+		npub = npub[:16] + "…"
+	}
+	sc.Data["Author"] = npub
+	sc.Data["Date"] = event.CreatedAt.Time()
+	sc.Data["Content"] = event.Content
+	return nil
+}
+
+// Events that could not be found are looked up again after this long
+const nostrRetryAfter = 24 * time.Hour
+
+// Returns a Nostr event, fetching it from the relays the first time. Events
+// are cached on disk, so restarts do not query the relays again, and so are
+// the events that could not be found, for a day.
+func GetNostrEvent(id string, relays []string) (*nostr.Event, error) {
+	name := filepath.Base(filepath.Clean("/nostr-" + id))
+	dir := NostrCacheDir()
+	cached, missing := path.Join(dir, name+".json"), path.Join(dir, name+".missing")
+
+	var event nostr.Event
+	if content, err := os.ReadFile(cached); err == nil {
+		if err := json.Unmarshal(content, &event); err == nil {
+			return &event, nil
+		}
+	}
+	if info, err := os.Stat(missing); err == nil && time.Since(info.ModTime()) < nostrRetryAfter {
+		return nil, fmt.Errorf("could not find nostr event %v, retrying after %v", id, info.ModTime().Add(nostrRetryAfter).Format(time.DateTime))
+	}
+
+	if len(relays) == 0 {
+		relays = defaultRelays
+	}
+	ctx, cancel := context.WithTimeout(AppContext, 10*time.Second)
+	defer cancel()
+	for _, url := range relays {
+		relay, err := nostr.RelayConnect(ctx, url)
+		if err != nil {
+			Log("render").Debug().Err(err).Msgf("failed to connect to relay %v", url)
+			continue
+		}
+		events, err := relay.QuerySync(ctx, nostr.Filter{IDs: []string{id}, Limit: 1})
+		relay.Close()
+		if err != nil || len(events) == 0 {
+			continue
+		}
+
+		if err := writeNostrCache(dir, cached, events[0]); err != nil {
+			Log("render").Warn().Err(err).Msgf("Could not cache nostr event %v", id)
+		}
+		os.Remove(missing)
+		return events[0], nil
+	}
+
+	// A lookup interrupted by the shutdown did not fail
+	if AppContext.Err() == nil {
+		if err := os.MkdirAll(dir, os.ModePerm); err == nil {
+			os.WriteFile(missing, nil, 0644)
+		}
+	}
+	return nil, fmt.Errorf("could not find nostr event %v", id)
+}
+
+// The folder of the cached Nostr events, with the generated pages. It is not
+// served as static files, and the watcher does not look into it.
+func NostrCacheDir() string {
+	return path.Join(Site().Config.ContentPath, "content", "nostr")
+}
+
+func writeNostrCache(dir, file string, event *nostr.Event) error {
+	eventJson, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(file, eventJson, 0644)
+}
+
+func gistShortcode(sc *Shortcode) error {
+	file := sc.Get("file", 0)
+	lang := sc.Get("lang", 1)
+	if lang == "" {
+		lang = strings.TrimPrefix(filepath.Ext(file), ".")
+	}
+	sc.Data["File"] = file
+
+	// Gists are local files stored in the gists/ folder of the content path
+	content, err := os.ReadFile(path.Join(Site().Config.ContentPath, "gists", filepath.Clean("/"+file)))
+	if err != nil {
+		return err
+	}
+	fence := "```"
+	for strings.Contains(string(content), fence) {
+		fence += "`"
+	}
+	code, err := ConvertMarkdown([]byte(fmt.Sprintf("%v%v\n%v\n%v\n", fence, lang, strings.TrimRight(string(content), "\n"), fence)))
+	if err != nil {
+		return err
+	}
+	sc.Data["Code"] = template.HTML(code)
+	return nil
+}
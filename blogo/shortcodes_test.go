@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestGetNostrEventCache(t *testing.T) {
+	dir := t.TempDir()
+	withConfig(t, func(c *Config) { c.ContentPath = dir })
+	cache := NostrCacheDir()
+	if err := os.MkdirAll(cache, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	// A cached event is read from disk, without any relay
+	want := nostr.Event{ID: "abc", Content: "Hello Nostr", CreatedAt: nostr.Timestamp(1700000000)}
+	eventJson, _ := json.Marshal(want)
+	if err := os.WriteFile(filepath.Join(cache, "nostr-abc.json"), eventJson, 0644); err != nil {
+		t.Fatal(err)
+	}
+	event, err := GetNostrEvent("abc", []string{"ws://127.0.0.1:1"})
+	if err != nil || event.Content != want.Content {
+		t.Fatalf("GetNostrEvent = %v, %v, want the cached event", event, err)
+	}
+
+	// A failure is cached too
+	missing := filepath.Join(cache, "nostr-def.missing")
+	if _, err := GetNostrEvent("def", []string{"ws://127.0.0.1:1"}); err == nil {
+		t.Fatal("found an event on an unreachable relay")
+	}
+	info, err := os.Stat(missing)
+	if err != nil {
+		t.Fatalf("the failure was not cached: %v", err)
+	}
+	start := time.Now()
+	if _, err := GetNostrEvent("def", nil); err == nil || time.Since(start) > time.Second {
+		t.Errorf("cached failure took %v, err %v", time.Since(start), err)
+	}
+
+	// And looked up again once it expires
+	old := info.ModTime().Add(-nostrRetryAfter)
+	os.Chtimes(missing, old, old)
+	GetNostrEvent("def", []string{"ws://127.0.0.1:1"})
+	if info, err := os.Stat(missing); err != nil || !info.ModTime().After(old) {
+		t.Errorf("expired failure was not looked up again")
+	}
+
+	// Nothing is cached where it would be served or watched
+	if _, err := os.Stat(filepath.Join(dir, "static")); !os.IsNotExist(err) {
+		t.Errorf("the cache wrote into the static folder: %v", err)
+	}
+}
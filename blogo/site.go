@@ -0,0 +1,65 @@
+package main
+
+import (
+	"html/template"
+	"sync"
+	"sync/atomic"
+)
+
+// Everything the watcher reloads while the server is running. A reload never
+// changes it: it builds a new one and swaps it in, so a request reads one
+// consistent version of the site from Site().
+type siteState struct {
+	Config    Config
+	Theme     ThemeFS
+	Templates Templates
+	// UI strings by language, loaded from the i18n/<lang>.yaml files of the
+	// theme and of the content folder
+	I18n map[string]map[string]string
+	// Site-wide data loaded from the data folder, keyed by file name:
+	// data/social.yaml is available to the templates as .Data.social
+	Data map[string]interface{}
+	// Stylesheet for the highlighted code blocks, served at /static/chroma.css
+	ChromaCss []byte
+	// Redirects read from redirects.yaml, from an old path to a new path or URL
+	Redirects map[string]string
+}
+
+// The templates of the theme
+type Templates struct {
+	Index, Tag, Tags, Archive, Post, NotFound, Error *template.Template
+	// Alternative post templates, selected with the Layout field
+	Layouts    map[string]*template.Template
+	Shortcodes *template.Template
+}
+
+var site atomic.Pointer[siteState]
+
+// Only one reload changes the site at a time
+var siteMu sync.Mutex
+
+func init() {
+	site.Store(&siteState{
+		Config:    DefaultConfig(),
+		I18n:      map[string]map[string]string{},
+		Data:      map[string]interface{}{},
+		Redirects: map[string]string{},
+	})
+}
+
+// Returns the current version of the site. It is shared and must not be
+// modified, use UpdateSite instead.
+func Site() *siteState {
+	return site.Load()
+}
+
+// Swaps in a copy of the site changed by update. The maps of the site are
+// shared with the previous version, so update replaces them instead of
+// changing them.
+func UpdateSite(update func(s *siteState)) {
+	siteMu.Lock()
+	defer siteMu.Unlock()
+	next := *site.Load()
+	update(&next)
+	site.Store(&next)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Changes the config of the site for a test, restoring it afterwards
+func withConfig(t *testing.T, change func(c *Config)) {
+	t.Helper()
+	previous := Site()
+	UpdateSite(func(s *siteState) { change(&s.Config) })
+	t.Cleanup(func() { site.Store(previous) })
+}
+
+// Sets the timezone of the site for a test
+func withTimezone(t *testing.T, name string) {
+	t.Helper()
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("loading timezone %v: %v", name, err)
+	}
+	withConfig(t, func(c *Config) {
+		c.Timezone, c.Location = name, location
+	})
+}
+
+// Opens the in-memory database once for the tests that store articles
+func withBadger(t *testing.T) {
+	t.Helper()
+	if Badger.DB == nil {
+		InitBadger()
+	}
+}
+
+func TestUpdateSiteKeepsSnapshots(t *testing.T) {
+	withConfig(t, func(c *Config) { c.Title = "Before" })
+	before := Site()
+	UpdateSite(func(s *siteState) { s.Config.Title = "After" })
+
+	if before.Config.Title != "Before" {
+		t.Errorf("a snapshot changed to %q", before.Config.Title)
+	}
+	if Site().Config.Title != "After" {
+		t.Errorf("Site() = %q, want the updated site", Site().Config.Title)
+	}
+}
@@ -1,53 +1,96 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"html/template"
 	"os"
 	"path"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-// Loads an article from a markdown file and stores it in Redis
+// Renders the static HTML of an article
 func GenerateArticleStatic(article ArticleData) (err error) {
+	defer prometheus.NewTimer(renderDuration).ObserveDuration()
+	return generateStatic(article, fmt.Sprintf("%v/content", Site().Config.ContentPath))
+}
+
+// Renders the static HTML of a page, kept apart from the articles so their
+// slugs can not clash
+func GeneratePageStatic(page ArticleData) (err error) {
+	return generateStatic(page, fmt.Sprintf("%v/content/pages", Site().Config.ContentPath))
+}
+
+func generateStatic(article ArticleData, blogPath string) error {
+	site := Site()
 	varmap := map[string]interface{}{
 		"Article": article,
-		"Blogo":   Blogo,
-	}
-	switch article.Slug {
-	case "about":
-		About.Slug = "about"
-		About.Data = article
-	default:
-		blogPath := fmt.Sprintf("%v/content", os.Getenv("CONTENT_PATH"))
-		_, err := os.Stat(blogPath)
-
-		if os.IsNotExist(err) {
-			if err := os.Mkdir(blogPath, os.ModePerm); err != nil {
-				return fmt.Errorf("error creating blog directory: %v", err)
-			}
-		} else if err != nil {
-			return fmt.Errorf("error checking blog directory: %v", err)
-		}
+		"Blogo":   site.Config,
+		"Data":    site.Data,
+		"Lang":    article.Lang,
+	}
 
-		filePath := fmt.Sprintf("%v/%v.html", blogPath, article.Slug)
-		file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-		if err != nil {
-			return fmt.Errorf("error creating static HTML file: %v", err)
+	_, err := os.Stat(blogPath)
+	if os.IsNotExist(err) {
+		if err := os.MkdirAll(blogPath, os.ModePerm); err != nil {
+			return fmt.Errorf("error creating blog directory: %v", err)
 		}
+	} else if err != nil {
+		return fmt.Errorf("error checking blog directory: %v", err)
+	}
 
-		err = PostTmpl.ExecuteTemplate(file, "base", varmap)
-		if err != nil {
-			return fmt.Errorf("error writing static HTML: %v", err)
-		}
+	var html bytes.Buffer
+	err = site.Templates.Article(article).ExecuteTemplate(&html, "base", varmap)
+	if err != nil {
+		return fmt.Errorf("error writing static HTML: %v", err)
+	}
 
+	filePath := fmt.Sprintf("%v/%v.html", blogPath, article.Slug)
+	if err := os.WriteFile(filePath, html.Bytes(), 0644); err != nil {
+		return fmt.Errorf("error creating static HTML file: %v", err)
+	}
+	// Served as they are to the clients that accept them
+	if err := writePrecompressed(filePath, html.Bytes()); err != nil {
+		return fmt.Errorf("error compressing static HTML: %v", err)
 	}
 	return nil
 }
 
+// Returns the template for the article's layout, falling back to post.html
+func (t Templates) Article(article ArticleData) *template.Template {
+	if tmpl, ok := t.Layouts[article.Layout]; ok {
+		return tmpl
+	}
+	if article.Layout != "" && article.Layout != "post" {
+		Log("render").Warn().Msgf("Layout %q of article %v not found, using post", article.Layout, article.Slug)
+	}
+	return t.Post
+}
+
+// Renders the static HTML of all the loaded articles and pages again, used
+// when the templates or the navigation change
+func RegenerateStatics() error {
+	var errs []error
+	for _, article := range Badger.GetAllArticles() {
+		if err := GenerateArticleStatic(article); err != nil {
+			errs = append(errs, fmt.Errorf("%v: %v", article.Slug, err))
+		}
+	}
+	for _, page := range Badger.GetAllPages() {
+		if err := GeneratePageStatic(page); err != nil {
+			errs = append(errs, fmt.Errorf("page %v: %v", page.Slug, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 func RemoveArticleStatic(filepath string) (err error) {
 	slug, _ := ParseFilePath(filepath)
 	filename := fmt.Sprintf("%v.html", slug)
 
-	blogPath := fmt.Sprintf("%v/content", os.Getenv("CONTENT_PATH"))
+	blogPath := fmt.Sprintf("%v/content", Site().Config.ContentPath)
 
-	return os.Remove(path.Join(blogPath, filename))
+	return removeGenerated(path.Join(blogPath, filename))
 }
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// A file that could not be loaded. The previous good version of the article,
+// if any, keeps being served until the file is fixed.
+type LoadError struct {
+	File  string    `json:"file"`
+	Error string    `json:"error"`
+	Time  time.Time `json:"time"`
+}
+
+var loadErrors = struct {
+	sync.RWMutex
+	errors map[string]LoadError
+}{errors: map[string]LoadError{}}
+
+func SetLoadError(file string, err error) {
+	loadErrors.Lock()
+	defer loadErrors.Unlock()
+	loadErrors.errors[file] = LoadError{File: file, Error: err.Error(), Time: time.Now()}
+}
+
+func ClearLoadError(file string) {
+	loadErrors.Lock()
+	defer loadErrors.Unlock()
+	delete(loadErrors.errors, file)
+}
+
+// Returns the current load errors sorted by file name
+func GetLoadErrors() []LoadError {
+	loadErrors.RLock()
+	defer loadErrors.RUnlock()
+	errors := make([]LoadError, 0, len(loadErrors.errors))
+	for _, e := range loadErrors.errors {
+		errors = append(errors, e)
+	}
+	sort.Slice(errors, func(i, j int) bool {
+		return errors[i].File < errors[j].File
+	})
+	return errors
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadErrors(t *testing.T) {
+	t.Cleanup(func() {
+		ClearLoadError("b.md")
+		ClearLoadError("a.md")
+	})
+	SetLoadError("b.md", errors.New("broken"))
+	SetLoadError("a.md", errors.New("first"))
+	SetLoadError("a.md", errors.New("second"))
+
+	got := GetLoadErrors()
+	if len(got) != 2 || got[0].File != "a.md" || got[0].Error != "second" || got[1].File != "b.md" {
+		t.Fatalf("GetLoadErrors = %+v", got)
+	}
+	ClearLoadError("a.md")
+	if got := GetLoadErrors(); len(got) != 1 || got[0].File != "b.md" {
+		t.Errorf("after clearing a.md: %+v", got)
+	}
+}
+
+func TestReloadArticleRecordsErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "broken.md")
+	if err := os.WriteFile(file, []byte("---\nTitle: [\n---\nBody"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ClearLoadError(file) })
+
+	if err := ReloadArticle(file); err == nil {
+		t.Fatal("loaded an article with broken front matter")
+	}
+	if errs := GetLoadErrors(); len(errs) != 1 || errs[0].File != file {
+		t.Errorf("load errors %+v, want one for %v", errs, file)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Symbols that would otherwise be dropped from the slug, so c++ and c# do
+// not end up as the same tag
+var tagSymbols = strings.NewReplacer("++", "pp", "#", "sharp", "+", "plus")
+
+// Returns the URL of a tag, like "Machine Learning" for machine-learning.
+// Tags are compared by their slug, so "Go", "go" and the aliases of go are
+// the same tag.
+func TagSlug(tag string) string {
+	slug := slugify(tag)
+	if alias, ok := Site().Config.TagAliases[slug]; ok {
+		return slugify(alias)
+	}
+	return slug
+}
+
+// Lowercases a tag and turns everything that is not a letter or a digit into
+// a single dash. Letters of any script are kept, "Café" is café.
+func slugify(tag string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range tagSymbols.Replace(strings.ToLower(tag)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(r)
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// Returns the slugs of the tags of an article without duplicates
+func ArticleTags(article ArticleData) []string {
+	var slugs []string
+	for _, tag := range article.Tags {
+		slug := TagSlug(tag)
+		if slug != "" && !StringInSlice(slug, slugs) {
+			slugs = append(slugs, slug)
+		}
+	}
+	return slugs
+}
+
+// Returns the tags of the listed articles of a language with how many
+// articles have them, the most used first
+func AllTags(lang string) []Tag {
+	counts := map[string]int{}
+	spellings := map[string]map[string]int{}
+	for _, article := range ListedArticles(lang) {
+		for _, tag := range article.Tags {
+			slug := TagSlug(tag)
+			if slug == "" {
+				continue
+			}
+			if spellings[slug] == nil {
+				spellings[slug] = map[string]int{}
+			}
+			spellings[slug][tag]++
+		}
+		for _, slug := range ArticleTags(article) {
+			counts[slug]++
+		}
+	}
+
+	tags := make([]Tag, 0, len(counts))
+	for slug, count := range counts {
+		tag := GetTag(slug)
+		if _, ok := tagData(slug)["title"]; !ok {
+			tag.Name = mostUsed(spellings[slug])
+		}
+		tag.Count = count
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Slug < tags[j].Slug
+	})
+	return tags
+}
+
+// Returns a tag with its title and description from data/tags.yaml. The
+// title defaults to the slug.
+func GetTag(slug string) Tag {
+	tag := Tag{Slug: slug, Name: slug}
+	data := tagData(slug)
+	if title, ok := data["title"].(string); ok && title != "" {
+		tag.Name = title
+	}
+	if description, ok := data["description"].(string); ok {
+		tag.Description = description
+	}
+	return tag
+}
+
+// Returns the entry of a tag in data/tags.yaml. A tag can be described with
+// just a string, or with a title and a description.
+func tagData(slug string) map[string]interface{} {
+	tags, _ := Site().Data["tags"].(map[string]interface{})
+	for key, value := range tags {
+		if TagSlug(key) != slug {
+			continue
+		}
+		switch value := value.(type) {
+		case string:
+			return map[string]interface{}{"description": value}
+		case map[string]interface{}:
+			return value
+		}
+	}
+	return nil
+}
+
+// Returns the spelling of a tag used by most articles
+func mostUsed(spellings map[string]int) string {
+	best := ""
+	for spelling, count := range spellings {
+		if count > spellings[best] || (count == spellings[best] && spelling < best) {
+			best = spelling
+		}
+	}
+	return best
+}
@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Go":               "go",
+		"Machine Learning": "machine-learning",
+		"  self-hosting  ": "self-hosting",
+		"C++":              "cpp",
+		"C#":               "csharp",
+		"a+b":              "aplusb",
+		"Café":             "café",
+		"日本語":              "日本語",
+		"rock 'n' roll!":   "rock-n-roll",
+		"--":               "",
+	}
+	for tag, want := range tests {
+		if got := slugify(tag); got != want {
+			t.Errorf("slugify(%q) = %q, want %q", tag, got, want)
+		}
+	}
+}
+
+func TestTagSlug(t *testing.T) {
+	withConfig(t, func(c *Config) {
+		c.TagAliases = map[string]string{"golang": "Go"}
+	})
+	tests := map[string]string{
+		"Go":     "go",
+		"golang": "go",
+		"GoLang": "go",
+		"Rust":   "rust",
+	}
+	for tag, want := range tests {
+		if got := TagSlug(tag); got != want {
+			t.Errorf("TagSlug(%q) = %q, want %q", tag, got, want)
+		}
+	}
+}
+
+func TestGetTag(t *testing.T) {
+	previous := Site()
+	UpdateSite(func(s *siteState) {
+		s.Data = map[string]interface{}{"tags": map[string]interface{}{
+			"Go":       "Posts about Go",
+			"selfhost": map[string]interface{}{"title": "Self-hosting", "description": "Running my own services"},
+		}}
+	})
+	t.Cleanup(func() { site.Store(previous) })
+
+	tests := map[string]Tag{
+		"go":       {Slug: "go", Name: "go", Description: "Posts about Go"},
+		"selfhost": {Slug: "selfhost", Name: "Self-hosting", Description: "Running my own services"},
+		"rust":     {Slug: "rust", Name: "rust"},
+	}
+	for slug, want := range tests {
+		if got := GetTag(slug); got != want {
+			t.Errorf("GetTag(%q) = %+v, want %+v", slug, got, want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+)
+
+// The default theme, built into the binary
+//
+//go:embed all:themes/default
+var defaultThemeFS embed.FS
+
+// ThemeFS looks up the templates and static files of the site. Files in the
+// content folder override the ones of the selected theme, which override the
+// ones of the default theme.
+type ThemeFS []fs.FS
+
+func LoadTheme(name string) (ThemeFS, error) {
+	defaultTheme, err := fs.Sub(defaultThemeFS, "themes/default")
+	if err != nil {
+		return nil, err
+	}
+
+	theme := ThemeFS{os.DirFS(Site().Config.ContentPath)}
+	if name != "" && name != "default" {
+		dir := ThemeDir(name)
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("theme %q not found in %v", name, dir)
+		}
+		theme = append(theme, os.DirFS(dir))
+	}
+	return append(theme, defaultTheme), nil
+}
+
+// Returns the folder of an installed theme
+func ThemeDir(name string) string {
+	return path.Join(Site().Config.ContentPath, "themes", name)
+}
+
+// Opens the file from the first layer that has it
+func (t ThemeFS) Open(name string) (fs.File, error) {
+	for _, layer := range t {
+		f, err := layer.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// Lists the files of a folder across all the layers, so an override adds to
+// the folder instead of hiding it
+func (t ThemeFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	seen := map[string]bool{}
+	var entries []fs.DirEntry
+	found := false
+	for _, layer := range t {
+		layerEntries, err := fs.ReadDir(layer, name)
+		if err != nil {
+			continue
+		}
+		found = true
+		for _, entry := range layerEntries {
+			if !seen[entry.Name()] {
+				seen[entry.Name()] = true
+				entries = append(entries, entry)
+			}
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// Static files served under /static
+func (t ThemeFS) Static() fs.FS {
+	static, _ := fs.Sub(t, "static")
+	return static
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Writes the files of a content folder for a test and uses it as the site's
+func withContent(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	withConfig(t, func(c *Config) { c.ContentPath = dir })
+	return dir
+}
+
+func TestLoadTheme(t *testing.T) {
+	withContent(t, map[string]string{
+		"templates/post.html":              "content post",
+		"themes/dark/templates/post.html":  "theme post",
+		"themes/dark/templates/index.html": "theme index",
+		"themes/dark/static/css/dark.css":  "body{}",
+	})
+
+	theme, err := LoadTheme("dark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		// The content folder wins over the theme, which wins over the default
+		"templates/post.html":  "content post",
+		"templates/index.html": "theme index",
+	}
+	for name, want := range tests {
+		if got, err := fs.ReadFile(theme, name); err != nil || string(got) != want {
+			t.Errorf("%v = %q, %v, want %q", name, got, err, want)
+		}
+	}
+	if _, err := fs.ReadFile(theme, "templates/base.html"); err != nil {
+		t.Errorf("the default theme does not fill in base.html: %v", err)
+	}
+
+	// Overrides add to a folder instead of hiding it
+	entries, err := fs.ReadDir(theme.Static(), "css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	for _, entry := range entries {
+		names[entry.Name()] = true
+	}
+	if !names["dark.css"] || !names["markdown.css"] {
+		t.Errorf("static/css has %v, want the files of both themes", names)
+	}
+
+	if _, err := LoadTheme("missing"); err == nil {
+		t.Error("loaded a theme that is not installed")
+	}
+}
+
+func TestInitTemplatesKeepsWorkingSet(t *testing.T) {
+	dir := withContent(t, nil)
+	if err := InitTemplates(); err != nil {
+		t.Fatalf("InitTemplates with the default theme: %v", err)
+	}
+	working := Site().Templates.Index
+
+	os.MkdirAll(filepath.Join(dir, "templates"), os.ModePerm)
+	os.WriteFile(filepath.Join(dir, "templates", "index.html"), []byte(`{{define "main"}}{{.Oops`), 0644)
+	if err := InitTemplates(); err == nil {
+		t.Fatal("InitTemplates accepted a broken template")
+	}
+	if Site().Templates.Index != working {
+		t.Error("a broken template replaced the working ones")
+	}
+}
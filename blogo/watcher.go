@@ -1,72 +1,336 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"os"
+	"path"
+	"path/filepath"
 	"strings"
 
 	"github.com/fsnotify/fsnotify"
 )
 
-func InitWatcher() {
+// Reloads the content, templates and config when their files change, until
+// the context is canceled
+func InitWatcher(ctx context.Context) error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("could not start the file watcher: %v", err)
 	}
 	defer watcher.Close()
 
-	done := make(chan bool)
-	go func() {
-		for {
-			select {
-			case event, ok := <-watcher.Events:
-				if !ok {
-					return
-				}
-				if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create {
-					if strings.HasSuffix(event.Name, ".md") {
-						log.Printf("Reloading article: %v", event.Name)
-						article, _ := GetArticleFromFile(event.Name)
-						if article.Slug != "" {
-							LoadArticle(article)
-							GenerateArticleStatic(article)
-						}
-						UpdateFeed()
-					}
-				}
+	contentPath := Site().Config.ContentPath
+	articlesDir := path.Join(contentPath, "articles")
+	pagesDir := path.Join(contentPath, "pages")
+	dataDir := path.Join(contentPath, "data")
 
-				// On article delete, remove it from the map
-				if event.Op&fsnotify.Remove == fsnotify.Remove {
-					if strings.HasSuffix(event.Name, ".md") {
-						log.Printf("Removing article: %v", event.Name)
-						RemoveArticle(event.Name)
-						RemoveArticleStatic(event.Name)
-						UpdateFeed()
-					}
-				}
+	err = watcher.Add(articlesDir)
+	if err != nil {
+		return fmt.Errorf("could not watch %v: %v", articlesDir, err)
+	}
 
-				// If renamed or moved, remove the old article from the map
-				if event.Op&fsnotify.Rename == fsnotify.Rename {
-					if strings.HasSuffix(event.Name, ".md") {
-						log.Printf("Replacing article: %v", event.Name)
-						RemoveArticle(event.Name)
-						RemoveArticleStatic(event.Name)
-						UpdateFeed()
-					}
-				}
-			case err, ok := <-watcher.Errors:
-				if !ok {
-					return
+	// Pages, templates, static files and config are optional, watch them if present
+	addWatch(watcher, pagesDir)
+	addWatch(watcher, dataDir)
+	for _, root := range themeRoots() {
+		// To see the templates, static and i18n folders created later
+		addWatch(watcher, root)
+		for _, dir := range []string{"templates", "static", "i18n"} {
+			addWatchTree(watcher, path.Join(root, dir))
+		}
+	}
+	// Editors often save by renaming, so the folders are watched and not the
+	// files, like redirects.yaml in the content folder
+	addWatch(watcher, contentPath)
+	addWatch(watcher, filepath.Dir(EnvFile))
+	if ConfigFile != "" {
+		addWatch(watcher, filepath.Dir(ConfigFile))
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			Log("watcher").Debug().Msg("Stopping the file watcher")
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			name := themePath(event.Name)
+			// New folders need to be watched too, with the folders inside
+			// them when they are moved in
+			if event.Op&fsnotify.Create == fsnotify.Create && (inFolder(name, "templates") || inFolder(name, "static") || inFolder(name, "i18n")) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					addWatchTree(watcher, event.Name)
 				}
-				log.Println("error:", err)
 			}
+			switch {
+			case filepath.Dir(event.Name) == articlesDir:
+				watcherEvents.WithLabelValues("article").Inc()
+				handleArticleEvent(event)
+			case filepath.Dir(event.Name) == pagesDir:
+				watcherEvents.WithLabelValues("page").Inc()
+				handlePageEvent(event)
+			case strings.HasPrefix(event.Name, dataDir+"/"):
+				watcherEvents.WithLabelValues("data").Inc()
+				handleDataEvent(event)
+			case inFolder(name, "templates") || inFolder(name, "i18n"):
+				watcherEvents.WithLabelValues("template").Inc()
+				handleTemplateEvent(event, name)
+			case inFolder(name, "static"):
+				watcherEvents.WithLabelValues("static").Inc()
+				handleStaticEvent(event)
+			case filepath.Clean(event.Name) == RedirectsFile():
+				watcherEvents.WithLabelValues("redirects").Inc()
+				handleRedirectsEvent(event)
+			case isConfigFile(event.Name):
+				watcherEvents.WithLabelValues("config").Inc()
+				handleConfigEvent(event)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			Log("watcher").Error().Err(err).Msg("Watcher error")
 		}
-	}()
+	}
+}
 
-	err = watcher.Add(fmt.Sprintf("%v/articles", os.Getenv("CONTENT_PATH")))
-	if err != nil {
-		log.Fatal(err)
+func addWatch(watcher *fsnotify.Watcher, dir string) {
+	if _, err := os.Stat(dir); err != nil {
+		return
+	}
+	if err := watcher.Add(dir); err != nil {
+		Log("watcher").Error().Err(err).Msgf("Could not watch %v", dir)
+	}
+}
+
+// Watches a folder and all the folders inside it
+func addWatchTree(watcher *fsnotify.Watcher, dir string) {
+	filepath.Walk(dir, func(fpath string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() {
+			addWatch(watcher, fpath)
+		}
+		return nil
+	})
+}
+
+// The folders with templates and static files that are not built in
+func themeRoots() []string {
+	cfg := Site().Config
+	roots := []string{cfg.ContentPath}
+	if cfg.Theme != "" && cfg.Theme != "default" {
+		roots = append(roots, ThemeDir(cfg.Theme))
+	}
+	return roots
+}
+
+// Returns the path of a file relative to the content folder or the theme
+// folder it belongs to, like templates/post.html
+func themePath(name string) string {
+	// The theme folder is inside the content folder, so it is checked first
+	roots := themeRoots()
+	for i := len(roots) - 1; i >= 0; i-- {
+		if rel, err := filepath.Rel(roots[i], name); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return ""
+}
+
+// Whether a path relative to a theme folder is the folder dir or is inside it
+func inFolder(name, dir string) bool {
+	return name == dir || strings.HasPrefix(name, dir+"/")
+}
+
+func isConfigFile(name string) bool {
+	name = filepath.Clean(name)
+	return name == filepath.Clean(EnvFile) || (ConfigFile != "" && name == filepath.Clean(ConfigFile))
+}
+
+func handleArticleEvent(event fsnotify.Event) {
+	if !strings.HasSuffix(event.Name, ".md") {
+		return
+	}
+	if isLegacyAbout(event.Name) {
+		handleAboutEvent(event)
+		return
+	}
+
+	// A renamed article keeps its old URL as an alias
+	if event.Op&fsnotify.Create == fsnotify.Create {
+		if oldSlug, ok := RenamedFrom(event.Name); ok {
+			Log("watcher").Info().Msgf("Article %v was renamed, redirecting %v to it", event.Name, oldSlug)
+			if err := AddAliasToFile(event.Name, oldSlug); err != nil {
+				Log("watcher").Error().Err(err).Msgf("Could not add alias %v to %v", oldSlug, event.Name)
+			}
+		}
+	}
+
+	if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create {
+		Log("watcher").Info().Msgf("Reloading article: %v", event.Name)
+		// On error the previous version keeps being served
+		if err := ReloadArticle(event.Name); err == nil {
+			UpdateFeed()
+		}
+	}
+
+	// On article delete, remove it from the map
+	if event.Op&fsnotify.Remove == fsnotify.Remove {
+		Log("watcher").Info().Msgf("Removing article: %v", event.Name)
+		RemoveArticle(event.Name)
+		RemoveArticleStatic(event.Name)
+		UpdateFeed()
+	}
+
+	// If renamed or moved, remove the old article from the map
+	if event.Op&fsnotify.Rename == fsnotify.Rename {
+		Log("watcher").Info().Msgf("Replacing article: %v", event.Name)
+		RememberRename(event.Name)
+		RemoveArticle(event.Name)
+		RemoveArticleStatic(event.Name)
+		UpdateFeed()
+	}
+}
+
+func handlePageEvent(event fsnotify.Event) {
+	if !strings.HasSuffix(event.Name, ".md") {
+		return
+	}
+	if slug, _ := ParseFilePath(event.Name); slug == "about" {
+		handleAboutEvent(event)
+		return
+	}
+
+	if event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+		Log("watcher").Info().Msgf("Reloading page: %v", event.Name)
+		// On error the previous version keeps being served
+		if err := ReloadPage(event.Name); err != nil {
+			return
+		}
+	} else if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		RemovePage(event.Name)
+	} else {
+		return
+	}
+
+	// The navigation may have changed
+	if err := RegenerateStatics(); err != nil {
+		Log("watcher").Error().Err(err).Msg("Error regenerating pages:")
+	}
+}
+
+// The about page is pages/about.md or, until it is moved, articles/about.md,
+// so a change to either of them loads the pages again
+func handleAboutEvent(event fsnotify.Event) {
+	if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+		return
+	}
+
+	Log("watcher").Info().Msgf("Reloading the about page: %v changed", event.Name)
+	if err := LoadPages(); err != nil {
+		Log("watcher").Error().Err(err).Msg("Error loading pages")
+	}
+	if err := RegenerateStatics(); err != nil {
+		Log("watcher").Error().Err(err).Msg("Error regenerating pages:")
+	}
+}
+
+func handleDataEvent(event fsnotify.Event) {
+	if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+		return
+	}
+
+	Log("watcher").Info().Msgf("Reloading data: %v changed", event.Name)
+	if err := LoadData(); err != nil {
+		Log("watcher").Error().Err(err).Msg("Error loading data files")
+		return
+	}
+	if err := RegenerateStatics(); err != nil {
+		Log("watcher").Error().Err(err).Msg("Error regenerating pages:")
+	}
+}
+
+func handleTemplateEvent(event fsnotify.Event, name string) {
+	if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+		return
+	}
+	// A folder moved in brings templates that send no events of their own
+	if !(strings.HasSuffix(event.Name, ".html") || strings.HasSuffix(event.Name, ".yaml")) {
+		if info, err := os.Stat(event.Name); err != nil || !info.IsDir() {
+			return
+		}
+	}
+
+	Log("watcher").Info().Msgf("Reloading templates: %v changed", event.Name)
+	if err := InitTemplates(); err != nil {
+		// The previous templates keep being used until the error is fixed
+		Log("watcher").Error().Err(err).Msg("Could not reload templates")
+		SetLoadError("templates", err)
+		return
+	}
+	ClearLoadError("templates")
+
+	// Shortcodes are rendered into the articles, the post templates only
+	// into the static pages. A new templates folder can bring both.
+	switch {
+	case name == "templates" || inFolder(name, "templates/shortcodes"):
+		if err := LoadArticles(); err != nil {
+			Log("watcher").Error().Err(err).Msg("Error reloading articles:")
+		}
+	case name == "templates/base.html" || name == "templates/post.html" || inFolder(name, "templates/layouts") || inFolder(name, "i18n"):
+		if err := RegenerateStatics(); err != nil {
+			Log("watcher").Error().Err(err).Msg("Error regenerating article pages:")
+		}
+	}
+}
+
+// The pages link to the static files by their fingerprint, which changes
+// with their content
+func handleStaticEvent(event fsnotify.Event) {
+	if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+		return
+	}
+
+	Log("watcher").Debug().Msgf("Static file changed: %v", event.Name)
+	ResetFingerprints()
+	BumpGeneration()
+	if err := RegenerateStatics(); err != nil {
+		Log("watcher").Error().Err(err).Msg("Error regenerating pages:")
+	}
+}
+
+func handleRedirectsEvent(event fsnotify.Event) {
+	if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+		return
+	}
+
+	Log("watcher").Info().Msgf("Reloading redirects: %v changed", event.Name)
+	if err := LoadRedirects(); err != nil {
+		Log("watcher").Error().Err(err).Msg("Error loading redirects")
+	}
+}
+
+func handleConfigEvent(event fsnotify.Event) {
+	if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+		return
+	}
+
+	Log("watcher").Info().Msgf("Reloading config: %v changed", event.Name)
+	if err := ReloadConfig(); err != nil {
+		// The running config is kept until the error is fixed
+		Log("watcher").Error().Msgf("Could not reload config: %v", err)
+		SetLoadError(event.Name, err)
+		return
+	}
+	ClearLoadError(event.Name)
+
+	// Settings like the title or the markdown options end up in the pages
+	if err := InitTemplates(); err != nil {
+		Log("watcher").Error().Err(err).Msg("Could not reload templates")
+	}
+	if err := LoadArticles(); err != nil {
+		Log("watcher").Error().Err(err).Msg("Error reloading articles:")
 	}
-	<-done
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInitWatcherStopsOnShutdown(t *testing.T) {
+	withContent(t, map[string]string{"articles/hello.md": "---\nTitle: Hello\n---\n"})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- InitWatcher(ctx) }()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("InitWatcher = %v, want nil after the shutdown", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the watcher did not stop")
+	}
+}
+
+func TestInitWatcherWithoutArticles(t *testing.T) {
+	withContent(t, nil)
+	if err := InitWatcher(context.Background()); err == nil {
+		t.Error("InitWatcher started without an articles folder")
+	}
+}
+
+func TestInitWatcherWatchesNewThemeFolders(t *testing.T) {
+	withBadger(t)
+	dir := withContent(t, map[string]string{"articles/.keep": ""})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- InitWatcher(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	time.Sleep(100 * time.Millisecond)
+
+	// A templates folder moved into the content folder, with an empty
+	// layouts folder inside
+	moved := filepath.Join(t.TempDir(), "templates")
+	if err := os.MkdirAll(filepath.Join(moved, "layouts"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(moved, filepath.Join(dir, "templates")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	layout := `{{define "content"}}wide{{end}}`
+	if err := os.WriteFile(filepath.Join(dir, "templates", "layouts", "wide.html"), []byte(layout), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for Site().Templates.Layouts["wide"] == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("the layout of a new templates folder was not loaded")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -1,6 +1,6 @@
 /** @type {import('tailwindcss').Config} */
 module.exports = {
-  content: ["./templates/**/*.{html,js}"],
+  content: ["./blogo/themes/default/templates/**/*.{html,js}"],
   theme: {
     extend: {
       fontFamily: {